@@ -42,6 +42,10 @@ func main() {
 		flag.PrintDefaults()
 		os.Exit(0)
 	}
+	// verify redirects and exit
+	if application.Config.Verify != "" {
+		os.Exit(application.Verify())
+	}
 	// run the server
 	application.Run()
 }
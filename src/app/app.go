@@ -22,6 +22,7 @@ import (
 	"github.com/axelspringer/swerve/src/certificate"
 	"github.com/axelspringer/swerve/src/configuration"
 	"github.com/axelspringer/swerve/src/db"
+	"github.com/axelspringer/swerve/src/geoip"
 	"github.com/axelspringer/swerve/src/log"
 	"github.com/axelspringer/swerve/src/server"
 )
@@ -35,14 +36,42 @@ func (a *Application) Setup() {
 	log.SetupLogger(a.Config.LogLevel, a.Config.LogFormatter)
 	// set the table prefix
 	db.DBTablePrefix = a.Config.TablePrefix
+	// response for domains outside their validity window
+	db.InactiveRedirect = a.Config.InactiveRedirect
+	// signed debug responses
+	server.DebugSecret = a.Config.DebugSecret
+	// offline verification against an export needs no database
+	if a.Config.Verify != "" && a.Config.VerifyConfig != "" {
+		return
+	}
 	// database connection
 	var err error
 	a.DynamoDB, err = db.NewDynamoDB(&a.Config.DynamoDB, a.Config.Bootstrap)
 	if err != nil {
 		log.Fatalf("Can't setup db connection %#v", err)
 	}
+	// geo ip database
+	if a.Config.GeoIPDatabase != "" {
+		a.GeoIP, err = geoip.NewLocator(a.Config.GeoIPDatabase)
+		if err != nil {
+			log.Fatalf("Can't open the GeoIP database %#v", err)
+		}
+		a.GeoIP.Observe()
+		db.Geo = a.GeoIP
+	}
 	// cert manager
 	a.Certificates = certificate.NewManager(a.DynamoDB, a.Config.StagingCA)
+	a.Certificates.CertCache.PurgeExpired = a.Config.PurgeExpired
+	if a.Config.FallbackCert != "" {
+		if err = a.Certificates.LoadFallbackCertificate(a.Config.FallbackCert, a.Config.FallbackKey); err != nil {
+			log.Fatalf("Can't load the fallback certificate %#v", err)
+		}
+	}
+	// response for unknown hosts
+	a.Fallback, err = server.NewFallback(a.Config.Fallback, a.Config.FallbackTarget)
+	if err != nil {
+		log.Fatalf("Can't setup the fallback %#v", err)
+	}
 	// cache preload
 	a.Certificates.CertCache.UpdateDomainCache()
 	// backgroud update ticker
@@ -56,17 +85,17 @@ func (a *Application) Run() {
 	sigchan := make(chan os.Signal, 1)
 	signal.Notify(sigchan, os.Interrupt, syscall.SIGTERM)
 	// run the https listener
-	httpsServer := server.NewHTTPSServer(a.Config.HTTPSListener, a.Certificates)
+	httpsServer := server.NewHTTPSServer(a.Config.HTTPSListener, a.Certificates, a.Fallback)
 	go func() {
 		log.Fatal(httpsServer.Listen())
 	}()
 	// run the http listener
-	httpServer := server.NewHTTPServer(a.Config.HTTPListener, a.Certificates)
+	httpServer := server.NewHTTPServer(a.Config.HTTPListener, a.Certificates, a.Fallback)
 	go func() {
 		log.Fatal(httpServer.Listen())
 	}()
 	// run the api listener
-	apiServer := server.NewAPIServer(a.Config.APIListener, a.Config.APISecret, a.DynamoDB)
+	apiServer := server.NewAPIServer(a.Config.APIListener, a.Config.APISecret, a.DynamoDB, a.Certificates)
 	go func() {
 		log.Fatal(apiServer.Listen())
 	}()
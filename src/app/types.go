@@ -18,6 +18,8 @@ import (
 	"github.com/axelspringer/swerve/src/certificate"
 	"github.com/axelspringer/swerve/src/configuration"
 	"github.com/axelspringer/swerve/src/db"
+	"github.com/axelspringer/swerve/src/geoip"
+	"github.com/axelspringer/swerve/src/server"
 )
 
 // Application model
@@ -25,4 +27,6 @@ type Application struct {
 	Config       *configuration.Configuration
 	DynamoDB     *db.DynamoDB
 	Certificates *certificate.Manager
+	GeoIP        *geoip.Locator
+	Fallback     *server.Fallback
 }
@@ -0,0 +1,91 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/axelspringer/swerve/src/certificate"
+	"github.com/axelspringer/swerve/src/db"
+	"github.com/axelspringer/swerve/src/log"
+)
+
+// verifyCache returns the domain cache to verify against. An export file replaces the database
+func (a *Application) verifyCache() (*certificate.PersistentCertCache, error) {
+	if a.Config.VerifyConfig == "" {
+		return a.Certificates.CertCache, nil
+	}
+
+	file, err := os.Open(a.Config.VerifyConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var export db.ExportDomains
+	if err := json.NewDecoder(file).Decode(&export); err != nil {
+		return nil, err
+	}
+
+	domains := make([]db.Domain, 0, len(export.Domains))
+	for _, domain := range export.Domains {
+		sorted := domain.Sorted()
+		sorted.Compile()
+		domains = append(domains, *sorted)
+	}
+
+	cache := certificate.NewPersistentCertCache(nil)
+	cache.PollTicker.Stop()
+	cache.SetDomains(domains)
+
+	return cache, nil
+}
+
+// Verify evaluates the redirects of the verify csv file and prints the report. The exit code is 1 on failures
+func (a *Application) Verify() int {
+	file, err := os.Open(a.Config.Verify)
+	if err != nil {
+		log.Errorf("Can't open the verify file %v", err)
+		return 1
+	}
+	defer file.Close()
+
+	cases, err := db.ReadVerifyCSV(file)
+	if err != nil {
+		log.Errorf("Can't read the verify file %v", err)
+		return 1
+	}
+
+	cache, err := a.verifyCache()
+	if err != nil {
+		log.Errorf("Can't read the verify config %v", err)
+		return 1
+	}
+
+	report := db.Verify(cases, cache.IsDomainAcceptable)
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Error(err)
+		return 1
+	}
+
+	if report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
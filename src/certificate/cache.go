@@ -16,6 +16,7 @@ package certificate
 
 import (
 	"context"
+	"strings"
 	"sync"
 	"time"
 
@@ -46,15 +47,121 @@ func (c *PersistentCertCache) UpdateDomainCache() {
 		return
 	}
 
+	// report or purge expired entries
+	domains = c.handleExpired(domains, time.Now())
+
+	c.SetDomains(domains)
+}
+
+// SetDomains replaces the cached domains. The domains are expected to be sorted and compiled
+func (c *PersistentCertCache) SetDomains(domains []db.Domain) {
+	// create new domain map
+	domainsMap := map[string]db.Domain{}
+
+	for _, domain := range domains {
+		// entries stored before the host normalization
+		name, err := db.NormalizeHost(domain.Name)
+		if err != nil {
+			name = domain.Name
+		}
+		domainsMap[name] = domain
+	}
+
+	// aliases resolve to their primary entry, names of other entries win
+	for _, domain := range domains {
+		for _, alias := range domain.Aliases {
+			if other, ok := domainsMap[alias]; ok {
+				log.Warnf("Alias %s of %s is already used by %s", alias, domain.Name, other.Name)
+				continue
+			}
+			domainsMap[alias] = domain
+		}
+	}
+
 	// lock the map
 	c.MapMutex.Lock()
 	defer c.MapMutex.Unlock()
-	// create new domain map
-	c.DomainsMap = map[string]db.Domain{}
+	c.DomainsMap = domainsMap
+	c.Updated = time.Now()
+}
+
+// Domains returns the cached domains
+func (c *PersistentCertCache) Domains() []db.Domain {
+	c.MapMutex.Lock()
+	defer c.MapMutex.Unlock()
+
+	seen := map[string]bool{}
+	domains := []db.Domain{}
+	for _, domain := range c.DomainsMap {
+		if !seen[domain.Name] {
+			seen[domain.Name] = true
+			domains = append(domains, domain)
+		}
+	}
+
+	return domains
+}
+
+// CacheAge returns the time since the last domain cache update
+func (c *PersistentCertCache) CacheAge() time.Duration {
+	c.MapMutex.Lock()
+	defer c.MapMutex.Unlock()
+
+	return time.Since(c.Updated)
+}
+
+// handleExpired reports domains and path rules with an ended validity window. With
+// PurgeExpired they are removed from the database and the returned list
+func (c *PersistentCertCache) handleExpired(domains []db.Domain, now time.Time) []db.Domain {
+	res := []db.Domain{}
 
 	for _, domain := range domains {
-		c.DomainsMap[domain.Name] = domain
+		if domain.IsExpired(now) {
+			if !c.PurgeExpired {
+				log.Warnf("Domain %s expired at %s", domain.Name, domain.ValidUntil)
+				res = append(res, domain)
+				continue
+			}
+			if _, err := c.DB.DeleteByDomain(domain.Name); err != nil {
+				log.Errorf("Error while purging expired domain %s %v", domain.Name, err)
+				res = append(res, domain)
+				continue
+			}
+			for _, name := range domain.Names() {
+				c.DB.DeleteTLSCacheEntry(name)
+			}
+			log.Infof("Expired domain %s purged", domain.Name)
+			continue
+		}
+
+		cleaned, removed := domain.WithoutExpiredPaths(now)
+		if removed == 0 {
+			res = append(res, domain)
+			continue
+		}
+		if !c.PurgeExpired {
+			log.Warnf("Domain %s has %d expired path rules", domain.Name, removed)
+			res = append(res, domain)
+			continue
+		}
+		// domains changed since they were read are purged on the next update
+		cleaned.Modified = db.ModifiedAt(now)
+		if err := c.DB.UpdateDomain(cleaned, domain.Modified); err != nil {
+			if err == db.ErrConflict {
+				log.Infof("Domain %s changed while purging expired path rules", domain.Name)
+			} else {
+				log.Errorf("Error while purging expired path rules of %s %v", domain.Name, err)
+			}
+			res = append(res, domain)
+			continue
+		}
+		sorted := cleaned.Sorted()
+		sorted.Compile()
+		log.Infof("%d expired path rules of %s purged", removed, domain.Name)
+		res = append(res, *sorted)
 	}
+
+	return res
 }
 
 // Get cert by domain name
@@ -140,14 +247,31 @@ func (c *PersistentCertCache) Observe() error {
 }
 
 // IsDomainAcceptable test for domains in cache
-func (c *PersistentCertCache) IsDomainAcceptable(domain string) (*db.Domain, bool) {
-	// check non wildcard domains
+func (c *PersistentCertCache) IsDomainAcceptable(host string) (*db.Domain, bool) {
+	// wildcard names are never requested hosts
+	if strings.Contains(host, "*") {
+		return nil, false
+	}
+
+	domain, err := db.NormalizeHost(host)
+	if err != nil {
+		return nil, false
+	}
+
 	c.MapMutex.Lock()
 	defer c.MapMutex.Unlock()
 
-	if d, ok := c.DomainsMap[domain]; ok {
+	// check non wildcard domains and the aliases
+	if d, ok := c.DomainsMap[domain]; ok && (!d.Wildcard || d.Name != domain) {
 		return &d, ok
 	}
 
+	// check wildcard domains, the most specific one wins
+	for _, name := range db.WildcardNames(domain) {
+		if d, ok := c.DomainsMap[name]; ok && d.Wildcard && d.Name == name {
+			return &d, ok
+		}
+	}
+
 	return nil, false
 }
@@ -2,6 +2,13 @@ package certificate_test
 
 import (
 	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/axelspringer/swerve/src/certificate"
+	"github.com/axelspringer/swerve/src/db"
+	"github.com/axelspringer/swerve/src/db/dbtest"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -16,7 +23,153 @@ var _ = Describe("Cache", func() {
 	Context("Domain cache", func() {
 
 		It("Domain Cache lookup", func() {
+			cache := certificate.NewPersistentCertCache(nil)
+			cache.DomainsMap = map[string]db.Domain{
+				"example.com":            {Name: "example.com"},
+				"*.brand.com":            {Name: "*.brand.com", Wildcard: true},
+				"*.shop.brand.com":       {Name: "*.shop.brand.com", Wildcard: true},
+				"special.shop.brand.com": {Name: "special.shop.brand.com"},
+			}
+
+			domain, found := cache.IsDomainAcceptable("example.com")
+			Expect(found).To(BeTrue())
+			Expect(domain.Name).To(Equal("example.com"))
+
+			domain, found = cache.IsDomainAcceptable("www.brand.com")
+			Expect(found).To(BeTrue())
+			Expect(domain.Name).To(Equal("*.brand.com"))
+
+			domain, found = cache.IsDomainAcceptable("a.b.brand.com")
+			Expect(found).To(BeTrue())
+			Expect(domain.Name).To(Equal("*.brand.com"))
+
+			domain, found = cache.IsDomainAcceptable("de.shop.brand.com")
+			Expect(found).To(BeTrue())
+			Expect(domain.Name).To(Equal("*.shop.brand.com"))
+
+			domain, found = cache.IsDomainAcceptable("special.shop.brand.com")
+			Expect(found).To(BeTrue())
+			Expect(domain.Name).To(Equal("special.shop.brand.com"))
+
+			_, found = cache.IsDomainAcceptable("brand.com")
+			Expect(found).To(BeFalse())
+
+			_, found = cache.IsDomainAcceptable("*.brand.com")
+			Expect(found).To(BeFalse())
+
+			_, found = cache.IsDomainAcceptable("www.example.com")
+			Expect(found).To(BeFalse())
+
+			domain, found = cache.IsDomainAcceptable("EXAMPLE.com:8080")
+			Expect(found).To(BeTrue())
+			Expect(domain.Name).To(Equal("example.com"))
+
+			domain, found = cache.IsDomainAcceptable("www.brand.com.")
+			Expect(found).To(BeTrue())
+			Expect(domain.Name).To(Equal("*.brand.com"))
+
+			cache.DomainsMap["www.example.com"] = db.Domain{Name: "example.com"}
+			cache.DomainsMap["brand.com"] = db.Domain{Name: "*.brand.com", Wildcard: true}
+
+			domain, found = cache.IsDomainAcceptable("www.example.com")
+			Expect(found).To(BeTrue())
+			Expect(domain.Name).To(Equal("example.com"))
+
+			domain, found = cache.IsDomainAcceptable("brand.com")
+			Expect(found).To(BeTrue())
+			Expect(domain.Name).To(Equal("*.brand.com"))
+		})
+
+		It("Domain Cache update", func() {
+			cache := certificate.NewPersistentCertCache(nil)
+			cache.SetDomains([]db.Domain{
+				{Name: "example.com", Aliases: []string{"example.org", "brand.com"}},
+				{Name: "brand.com"},
+			})
+
+			domain, found := cache.IsDomainAcceptable("example.org")
+			Expect(found).To(BeTrue())
+			Expect(domain.Name).To(Equal("example.com"))
+
+			domain, found = cache.IsDomainAcceptable("brand.com")
+			Expect(found).To(BeTrue())
+			Expect(domain.Name).To(Equal("brand.com"))
+
+			Expect(cache.Domains()).To(HaveLen(2))
+			Expect(cache.CacheAge()).To(BeNumerically("<", time.Minute))
+		})
+
+		It("Domain Cache purges expired path rules keeping the stored order", func() {
+			past := time.Now().Add(-time.Hour).Format(time.RFC3339)
+			stored := func() db.Domain {
+				return db.Domain{
+					ID:           "1",
+					Name:         "example.com",
+					Redirect:     "https://www.example.com/",
+					RedirectCode: 301,
+					Created:      "2019-01-01T00:00:00Z",
+					Modified:     "2019-01-01T00:00:00Z",
+					PathMapping: &db.PathList{
+						{From: "/a", To: "/x", ValidUntil: past},
+						{From: "/b", To: "/y"},
+						{From: "/long/path", To: "/z"},
+					},
+				}
+			}
+
+			fake := dbtest.NewFakeDynamo()
+			database := &db.DynamoDB{Service: fake}
+			Expect(database.InsertDomain(stored())).To(BeNil())
+
+			cache := certificate.NewPersistentCertCache(database)
+			cache.PurgeExpired = true
+			cache.UpdateDomainCache()
+
+			domain, err := database.FetchByDomain("example.com")
+			Expect(err).To(BeNil())
+			Expect(*domain.PathMapping).To(HaveLen(2))
+			Expect((*domain.PathMapping)[0].From).To(Equal("/b"))
+			Expect((*domain.PathMapping)[1].From).To(Equal("/long/path"))
+
+			cached, found := cache.IsDomainAcceptable("example.com")
+			Expect(found).To(BeTrue())
+			Expect((*cached.PathMapping)[0].From).To(Equal("/long/path"))
+			Expect(cached.RuleIndex(&(*cached.PathMapping)[0])).To(Equal(1))
+		})
+
+		It("Domain Cache skips the purge of a domain changed concurrently", func() {
+			past := time.Now().Add(-time.Hour).Format(time.RFC3339)
+			fake := dbtest.NewFakeDynamo()
+			database := &db.DynamoDB{Service: fake}
+			Expect(database.InsertDomain(db.Domain{
+				ID:           "1",
+				Name:         "example.com",
+				Redirect:     "https://www.example.com/",
+				RedirectCode: 301,
+				Created:      "2019-01-01T00:00:00Z",
+				Modified:     "2019-01-01T00:00:00Z",
+				PathMapping: &db.PathList{
+					{From: "/a", To: "/x", ValidUntil: past},
+					{From: "/b", To: "/y"},
+				},
+			})).To(BeNil())
+
+			// an api edit between reading and purging the domain
+			fake.BeforeWrite = func(item map[string]*dynamodb.AttributeValue) {
+				item["modified"] = &dynamodb.AttributeValue{S: aws.String("2019-01-02T00:00:00Z")}
+			}
+
+			cache := certificate.NewPersistentCertCache(database)
+			cache.PurgeExpired = true
+			cache.UpdateDomainCache()
+
+			domain, err := database.FetchByDomain("example.com")
+			Expect(err).To(BeNil())
+			Expect(*domain.PathMapping).To(HaveLen(2))
+			Expect(domain.Modified).To(Equal("2019-01-02T00:00:00Z"))
 
+			_, found := cache.IsDomainAcceptable("example.com")
+			Expect(found).To(BeTrue())
 		})
 
 	})
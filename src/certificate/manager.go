@@ -71,8 +71,23 @@ func (m *Manager) AllowHostPolicy(_ context.Context, host string) error {
 	return nil
 }
 
-// GetCertificate wrapper for the cert getter
+// LoadFallbackCertificate loads the certificate served for unknown hosts
+func (m *Manager) LoadFallbackCertificate(certFile string, keyFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	m.Fallback = &cert
+	return nil
+}
+
+// GetCertificate wrapper for the cert getter. Unknown hosts get the fallback certificate if there is one
 func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if m.Fallback != nil {
+		if _, found := m.CertCache.IsDomainAcceptable(hello.ServerName); !found {
+			return m.Fallback, nil
+		}
+	}
 	return m.AcmeManager.GetCertificate(hello)
 }
 
@@ -15,6 +15,7 @@
 package certificate
 
 import (
+	"crypto/tls"
 	"sync"
 	"time"
 
@@ -26,13 +27,16 @@ import (
 type Manager struct {
 	CertCache   *PersistentCertCache
 	AcmeManager *autocert.Manager
+	Fallback    *tls.Certificate
 }
 
 // PersistentCertCache certificate cache
 type PersistentCertCache struct {
 	autocert.Cache
-	DB         *db.DynamoDB
-	PollTicker *time.Ticker
-	MapMutex   *sync.Mutex
-	DomainsMap map[string]db.Domain
+	DB           *db.DynamoDB
+	PollTicker   *time.Ticker
+	MapMutex     *sync.Mutex
+	DomainsMap   map[string]db.Domain
+	PurgeExpired bool
+	Updated      time.Time
 }
@@ -85,6 +85,45 @@ func (c *Configuration) FromEnv() {
 	if caStagingEnv := getOSPrefixEnv("STAGING"); caStagingEnv != nil {
 		c.StagingCA = len(*caStagingEnv) > 0 && *caStagingEnv != "0"
 	}
+
+	if geoIPDatabase := getOSPrefixEnv("GEOIP_DB"); geoIPDatabase != nil {
+		c.GeoIPDatabase = *geoIPDatabase
+	}
+
+	if inactiveRedirect := getOSPrefixEnv("INACTIVE_REDIRECT"); inactiveRedirect != nil {
+		c.InactiveRedirect = *inactiveRedirect
+	}
+
+	if purgeExpired := getOSPrefixEnv("PURGE_EXPIRED"); purgeExpired != nil {
+		c.PurgeExpired = len(*purgeExpired) > 0 && *purgeExpired != "0"
+	}
+
+	if fallback := getOSPrefixEnv("FALLBACK"); fallback != nil {
+		c.Fallback = *fallback
+	}
+
+	if fallbackTarget := getOSPrefixEnv("FALLBACK_TARGET"); fallbackTarget != nil {
+		c.FallbackTarget = *fallbackTarget
+	}
+
+	if fallbackCert := getOSPrefixEnv("FALLBACK_CERT"); fallbackCert != nil {
+		if fallbackKey := getOSPrefixEnv("FALLBACK_KEY"); fallbackKey != nil {
+			c.FallbackCert = *fallbackCert
+			c.FallbackKey = *fallbackKey
+		}
+	}
+
+	if verify := getOSPrefixEnv("VERIFY"); verify != nil {
+		c.Verify = *verify
+	}
+
+	if verifyConfig := getOSPrefixEnv("VERIFY_CONFIG"); verifyConfig != nil {
+		c.VerifyConfig = *verifyConfig
+	}
+
+	if debugSecret := getOSPrefixEnv("DEBUG_SECRET"); debugSecret != nil {
+		c.DebugSecret = *debugSecret
+	}
 }
 
 // FromParameter read config from application parameter
@@ -106,6 +145,17 @@ func (c *Configuration) FromParameter() {
 	apiListenerPtr := flag.String("api", "", "Set the API listener address")
 	apiSecret := flag.String("api-secret", "", "Set the api secret")
 
+	geoIPDatabasePtr := flag.String("geoip-db", "", "Path to the MaxMind GeoLite2 country database")
+	inactiveRedirectPtr := flag.String("inactive-redirect", "", "Redirect target for domains outside their validity window")
+	purgeExpiredPtr := flag.Bool("purge-expired", false, "Remove expired domains and path rules from the database")
+	fallbackPtr := flag.String("fallback", "", "Response for unknown hosts (notfound,redirect,page,close)")
+	fallbackTargetPtr := flag.String("fallback-target", "", "Redirect url or html page file of the unknown hosts fallback")
+	fallbackCertPtr := flag.String("fallback-cert", "", "Certificate file served to unknown hosts")
+	fallbackKeyPtr := flag.String("fallback-key", "", "Key file of the certificate served to unknown hosts")
+	verifyPtr := flag.String("verify", "", "Verify the redirects of a csv file (url,expected,code) and exit")
+	verifyConfigPtr := flag.String("verify-config", "", "Exported domains file to verify against instead of the database")
+	debugSecretPtr := flag.String("debug-secret", "", "Secret signing the tokens of debug responses")
+
 	versionPtr := flag.Bool("version", false, "Print the version of the application")
 	helpPtr := flag.Bool("help", false, "Print the default usage help dialog")
 
@@ -167,6 +217,43 @@ func (c *Configuration) FromParameter() {
 	if apiListenerPtr != nil && *apiListenerPtr != "" {
 		c.APIListener = *apiListenerPtr
 	}
+
+	if geoIPDatabasePtr != nil && *geoIPDatabasePtr != "" {
+		c.GeoIPDatabase = *geoIPDatabasePtr
+	}
+
+	if inactiveRedirectPtr != nil && *inactiveRedirectPtr != "" {
+		c.InactiveRedirect = *inactiveRedirectPtr
+	}
+
+	if purgeExpiredPtr != nil && *purgeExpiredPtr {
+		c.PurgeExpired = *purgeExpiredPtr
+	}
+
+	if fallbackPtr != nil && *fallbackPtr != "" {
+		c.Fallback = *fallbackPtr
+	}
+
+	if fallbackTargetPtr != nil && *fallbackTargetPtr != "" {
+		c.FallbackTarget = *fallbackTargetPtr
+	}
+
+	if fallbackCertPtr != nil && fallbackKeyPtr != nil && *fallbackCertPtr != "" && *fallbackKeyPtr != "" {
+		c.FallbackCert = *fallbackCertPtr
+		c.FallbackKey = *fallbackKeyPtr
+	}
+
+	if verifyPtr != nil && *verifyPtr != "" {
+		c.Verify = *verifyPtr
+	}
+
+	if verifyConfigPtr != nil && *verifyConfigPtr != "" {
+		c.VerifyConfig = *verifyConfigPtr
+	}
+
+	if debugSecretPtr != nil && *debugSecretPtr != "" {
+		c.DebugSecret = *debugSecretPtr
+	}
 }
 
 // NewConfiguration creates a new instance
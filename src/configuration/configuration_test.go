@@ -15,7 +15,6 @@
 package configuration_test
 
 import (
-	"errors"
 	"testing"
 
 	"github.com/axelspringer/swerve/src/db"
@@ -32,13 +31,13 @@ func TestConfiguration(t *testing.T) {
 var _ = Describe("Configuration", func() {
 	It("Domain struct validating", func() {
 		domain := &db.Domain{}
-		errList := domain.Validate()
-		Expect(errList).To(Equal([]error{
-			errors.New("Invalid id"),
-			errors.New("Invalid domain name"),
-			errors.New("Invalid domain date"),
-			errors.New("Invalid domain redirect target"),
-			errors.New("Invalid redirect http status code"),
+		errList := domain.Validate().Messages()
+		Expect(errList).To(Equal([]string{
+			"Invalid id",
+			"Invalid domain name",
+			"Invalid domain date",
+			"Invalid domain redirect target",
+			"Invalid redirect http status code",
 		}))
 	})
 })
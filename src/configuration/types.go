@@ -21,16 +21,26 @@ var Version string
 
 // Configuration model
 type Configuration struct {
-	HTTPListener  string
-	HTTPSListener string
-	APIListener   string
-	DynamoDB      db.DynamoConnection
-	TablePrefix   string
-	LogLevel      string
-	LogFormatter  string
-	Bootstrap     bool
-	Version       bool
-	Help          bool
-	StagingCA     bool
-	APISecret     string
+	HTTPListener     string
+	HTTPSListener    string
+	APIListener      string
+	DynamoDB         db.DynamoConnection
+	TablePrefix      string
+	LogLevel         string
+	LogFormatter     string
+	Bootstrap        bool
+	Version          bool
+	Help             bool
+	StagingCA        bool
+	APISecret        string
+	GeoIPDatabase    string
+	InactiveRedirect string
+	PurgeExpired     bool
+	Fallback         string
+	FallbackTarget   string
+	FallbackCert     string
+	FallbackKey      string
+	Verify           string
+	VerifyConfig     string
+	DebugSecret      string
 }
@@ -0,0 +1,86 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Names returns the name and the aliases of the domain
+func (d *Domain) Names() []string {
+	return append([]string{d.Name}, d.Aliases...)
+}
+
+// normalizeAliases stores the canonical form of the aliases and returns the invalid ones
+func (d *Domain) normalizeAliases() []string {
+	invalid := []string{}
+
+	for i, alias := range d.Aliases {
+		name, err := NormalizeHost(alias)
+		if err != nil || strings.Contains(name, "*") {
+			invalid = append(invalid, alias)
+			continue
+		}
+		if validURL, err := url.Parse("//" + name); err != nil || validURL.Path != "" {
+			invalid = append(invalid, alias)
+			continue
+		}
+		d.Aliases[i] = name
+	}
+
+	return invalid
+}
+
+// duplicateAliases returns the aliases used twice or equal to the domain name
+func (d *Domain) duplicateAliases() []string {
+	res := []string{}
+	seen := map[string]bool{d.Name: true}
+
+	for _, alias := range d.Aliases {
+		if seen[alias] {
+			res = append(res, alias)
+		}
+		seen[alias] = true
+	}
+
+	return res
+}
+
+// Conflicts returns the names and aliases of the domain already used by one of the other domains
+func (d *Domain) Conflicts(domains []Domain) []string {
+	used := map[string]bool{}
+	for i := range domains {
+		// entries stored before the host normalization are the domain itself as well
+		if canonical, err := NormalizeHost(domains[i].Name); domains[i].Name == d.Name || (err == nil && canonical == d.Name) {
+			continue
+		}
+		for _, name := range domains[i].Names() {
+			if canonical, err := NormalizeHost(name); err == nil {
+				name = canonical
+			}
+			used[name] = true
+		}
+	}
+
+	res := []string{}
+	for _, name := range d.Names() {
+		if used[name] {
+			res = append(res, name)
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,201 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	maxChainHops = 10
+)
+
+// Lookup finds the managed domain of a host
+type Lookup func(host string) (*Domain, bool)
+
+// Sorted returns a copy of the domain with the path map sorted like in the domain cache
+func (d Domain) Sorted() *Domain {
+	if d.PathMapping != nil {
+		paths := append(PathList{}, *d.PathMapping...)
+		d.PathMapping = &paths
+		d.sortPathMap()
+	}
+	return &d
+}
+
+// chainSamples returns the request urls covering the default redirect and every plain path rule
+func (d *Domain) chainSamples() []string {
+	host := d.Name
+	if d.Wildcard {
+		host = "www." + strings.TrimPrefix(d.Name, WildcardPrefix)
+	}
+
+	res := []string{"https://" + host + "/"}
+	if d.PathMapping == nil {
+		return res
+	}
+
+	for _, p := range *d.PathMapping {
+		if p.Regex || !strings.HasPrefix(p.From, "/") {
+			continue
+		}
+		res = append(res, "https://"+host+p.From)
+	}
+
+	return res
+}
+
+// chainKey treats urls with an empty path and the root path as the same url
+func chainKey(location string) string {
+	target, err := url.Parse(location)
+	if err != nil {
+		return location
+	}
+	if target.Path == "" {
+		target.Path = "/"
+	}
+	return target.String()
+}
+
+// resolveVariants resolves the url with every variant of a split to follow all of its targets
+func resolveVariants(domain *Domain, target *url.URL) []*Decision {
+	decision := domain.Resolve(urlRequest(target))
+	if decision.Cookie == nil {
+		return []*Decision{decision}
+	}
+
+	targets := domain.Targets
+	if decision.Rule != nil && len(decision.Rule.Targets) > 0 {
+		targets = decision.Rule.Targets
+	}
+
+	res := []*Decision{}
+	for i, t := range targets {
+		if t.Weight <= 0 {
+			continue
+		}
+		req := urlRequest(target)
+		req.AddCookie(&http.Cookie{Name: decision.Cookie.Name, Value: variantName(targets, i)})
+		res = append(res, domain.Resolve(req))
+	}
+
+	return res
+}
+
+// end completes the chain with the last hop as flatten suggestion
+func (c Chain) end() Chain {
+	if len(c.Hops) > 0 {
+		c.Flatten = c.Hops[len(c.Hops)-1]
+	}
+	return c
+}
+
+// follow resolves the location through the managed domains until it leaves them. Splits are
+// followed for every target, so a start can lead to several chains
+func follow(start string, lookup Lookup) []Chain {
+	return followLocation(Chain{Start: start}, map[string]bool{chainKey(start): true}, start, lookup)
+}
+
+// followLocation continues the chain at the location
+func followLocation(chain Chain, visited map[string]bool, location string, lookup Lookup) []Chain {
+	if len(chain.Hops) >= maxChainHops {
+		return []Chain{chain.end()}
+	}
+
+	target, err := url.Parse(location)
+	if err != nil || target.Host == "" {
+		return []Chain{chain.end()}
+	}
+
+	host, err := NormalizeHost(target.Host)
+	if err != nil {
+		return []Chain{chain.end()}
+	}
+
+	domain, found := lookup(host)
+	if !found {
+		return []Chain{chain.end()}
+	}
+
+	res := []Chain{}
+	for _, decision := range resolveVariants(domain, target) {
+		// proxied and static responses end the chain
+		if decision.Action != "" || decision.Location == "" {
+			res = append(res, chain.end())
+			continue
+		}
+
+		next := chain
+		next.Hops = append(append([]string{}, chain.Hops...), decision.Location)
+		key := chainKey(decision.Location)
+		if visited[key] {
+			next.Loop = true
+			res = append(res, next.end())
+			continue
+		}
+
+		nextVisited := map[string]bool{key: true}
+		for k := range visited {
+			nextVisited[k] = true
+		}
+		res = append(res, followLocation(next, nextVisited, decision.Location, lookup)...)
+	}
+
+	return res
+}
+
+// CheckChains follows the redirects of the domain through the managed domains. The
+// lookup is expected to return the domain itself for its own name
+func (d *Domain) CheckChains(lookup Lookup) ChainReport {
+	// every plain rule is followed, the index keeps large path maps from being scanned per sample
+	self := d.Sorted()
+	self.Compile()
+	sortedLookup := func(host string) (*Domain, bool) {
+		domain, found := lookup(host)
+		if found && domain.Name == d.Name {
+			return self, true
+		}
+		return domain, found
+	}
+
+	report := ChainReport{}
+	seen := map[string]bool{}
+	for _, sample := range self.chainSamples() {
+		for _, chain := range follow(sample, sortedLookup) {
+			// variants ending in the same way give the same chain
+			if seen[chain.String()] {
+				continue
+			}
+			seen[chain.String()] = true
+
+			switch {
+			case chain.Loop:
+				report.Loops = append(report.Loops, chain)
+			case len(chain.Hops) > 1:
+				report.Chains = append(report.Chains, chain)
+			}
+		}
+	}
+
+	return report
+}
+
+// String describes the chain
+func (c Chain) String() string {
+	return fmt.Sprintf("%s -> %s", c.Start, strings.Join(c.Hops, " -> "))
+}
@@ -0,0 +1,451 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// MatchPresent matches when the parameter exists
+	MatchPresent = "present"
+	// MatchEquals matches when one of the parameter values equals the condition value
+	MatchEquals = "equals"
+	// MatchMatches matches when one of the parameter values matches the condition regex
+	MatchMatches = "matches"
+)
+
+const (
+	// DeviceMobile matches phones
+	DeviceMobile = "mobile"
+	// DeviceTablet matches tablets
+	DeviceTablet = "tablet"
+	// DeviceDesktop matches everything else
+	DeviceDesktop = "desktop"
+)
+
+const (
+	// maxPatternCache is the number of compiled regexes kept until the cache is cleared
+	maxPatternCache = 10000
+)
+
+var (
+	continentCodes = map[string]bool{"AF": true, "AN": true, "AS": true, "EU": true, "NA": true, "OC": true, "SA": true}
+)
+
+var (
+	patternCache = map[string]*regexp.Regexp{}
+	patternMutex = &sync.RWMutex{}
+
+	tabletPattern = regexp.MustCompile(`(?i)ipad|tablet|kindle|silk|playbook`)
+	mobilePattern = regexp.MustCompile(`(?i)mobi|iphone|ipod|android|blackberry|opera mini|windows phone`)
+)
+
+// request holds the parsed request data the path rules are evaluated against
+type request struct {
+	*http.Request
+	host      string
+	path      string
+	matchPath string
+	fold      bool
+	slash     bool
+	rawQuery  string
+	query     url.Values
+	domain    *Domain
+	language  string
+	offered   bool
+	located   bool
+	country   string
+	continent string
+	captures  map[string]string
+	rest      string
+	time      time.Time
+}
+
+// location resolves the country and continent of the client once
+func (r *request) location() (string, string) {
+	if r.located {
+		return r.country, r.continent
+	}
+	r.located = true
+
+	if Geo == nil {
+		return "", ""
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	r.country, r.continent = Geo.Lookup(net.ParseIP(host))
+
+	return r.country, r.continent
+}
+
+// matchCode tests a location code against a list of codes
+func matchCode(code string, codes []string) bool {
+	if code == "" {
+		return false
+	}
+
+	for _, c := range codes {
+		if strings.EqualFold(c, code) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newRequest parses the request for the rule evaluation of the domain
+func newRequest(r *http.Request, d *Domain) *request {
+	req := &request{
+		Request:  r,
+		host:     r.Host,
+		path:     d.PathNormalization.path(r.URL.EscapedPath()),
+		rawQuery: r.URL.RawQuery,
+		query:    r.URL.Query(),
+		time:     time.Now(),
+		domain:   d,
+	}
+
+	req.matchPath = d.PathNormalization.matchPath(req.path)
+	req.fold = d.PathNormalization != nil && d.PathNormalization.CaseInsensitive
+	req.slash = d.PathNormalization != nil && d.PathNormalization.StripTrailingSlash && req.matchPath != "/"
+
+	if host, err := NormalizeHost(r.Host); err == nil {
+		req.host = host
+	} else if host, _, err := net.SplitHostPort(r.Host); err == nil {
+		req.host = host
+	}
+
+	return req
+}
+
+// compilePattern returns a cached compiled regex. The cache is cleared when it is full, so
+// patterns of changed or deleted rules don't pile up
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	patternMutex.RLock()
+	re, ok := patternCache[pattern]
+	patternMutex.RUnlock()
+	if ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	patternMutex.Lock()
+	if len(patternCache) >= maxPatternCache {
+		patternCache = map[string]*regexp.Regexp{}
+	}
+	patternCache[pattern] = re
+	patternMutex.Unlock()
+
+	return re, nil
+}
+
+// validMatch checks a match type and its value
+func validMatch(match string, value string) bool {
+	switch match {
+	case "", MatchPresent, MatchEquals:
+		return true
+	case MatchMatches:
+		_, err := compilePattern(value)
+		return err == nil
+	}
+
+	return false
+}
+
+// matchValues tests the values of a parameter against a match type and its value
+func matchValues(match string, value string, values []string, found bool) bool {
+	if !found {
+		return false
+	}
+
+	switch match {
+	case "", MatchPresent:
+		return true
+	case MatchEquals:
+		for _, v := range values {
+			if v == value {
+				return true
+			}
+		}
+	case MatchMatches:
+		re, err := compilePattern(value)
+		if err != nil {
+			return false
+		}
+		for _, v := range values {
+			if re.MatchString(v) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// valid checks the condition definition
+func (c *QueryCondition) valid() bool {
+	return c.Param != "" && validMatch(c.Match, c.Value)
+}
+
+// matches tests the condition against the request query. The order of the parameters doesn't matter
+func (c *QueryCondition) matches(query url.Values) bool {
+	values, ok := query[c.Param]
+	return matchValues(c.Match, c.Value, values, ok)
+}
+
+// valid checks the condition definition
+func (c *HeaderCondition) valid() bool {
+	return c.Header != "" && validMatch(c.Match, c.Value)
+}
+
+// matches tests the condition against the request headers
+func (c *HeaderCondition) matches(header http.Header) bool {
+	values, ok := header[http.CanonicalHeaderKey(c.Header)]
+	return matchValues(c.Match, c.Value, values, ok)
+}
+
+// valid checks the condition definition
+func (c *CookieCondition) valid() bool {
+	return c.Cookie != "" && validMatch(c.Match, c.Value)
+}
+
+// matches tests the condition against the request cookies
+func (c *CookieCondition) matches(r *http.Request) bool {
+	cookie, err := r.Cookie(c.Cookie)
+	if err != nil {
+		return matchValues(c.Match, c.Value, nil, false)
+	}
+	return matchValues(c.Match, c.Value, []string{cookie.Value}, true)
+}
+
+// detectDevice classifies the user agent. Android devices without the mobile token are tablets
+func detectDevice(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	if tabletPattern.MatchString(ua) || (strings.Contains(ua, "android") && !strings.Contains(ua, "mobile")) {
+		return DeviceTablet
+	}
+	if mobilePattern.MatchString(userAgent) {
+		return DeviceMobile
+	}
+	return DeviceDesktop
+}
+
+// pattern returns the compiled From regex, case insensitive for folded requests
+func (p *PathMappingEntry) pattern(req *request) (*regexp.Regexp, error) {
+	if req.fold {
+		return compilePattern("(?i)" + p.From)
+	}
+	return compilePattern(p.From)
+}
+
+// matchRegex matches the From regex against the request path and keeps the captures
+func (p *PathMappingEntry) matchRegex(req *request) bool {
+	re, err := p.pattern(req)
+	if err != nil {
+		return false
+	}
+
+	loc := re.FindStringSubmatchIndex(req.path)
+	if loc == nil {
+		return false
+	}
+
+	req.captures = map[string]string{}
+	for i, name := range re.SubexpNames() {
+		if i == 0 || loc[2*i] < 0 {
+			continue
+		}
+		value := req.path[loc[2*i]:loc[2*i+1]]
+		req.captures[strconv.Itoa(i)] = value
+		if name != "" {
+			req.captures[name] = value
+		}
+	}
+	req.rest = req.path[loc[1]:]
+
+	return true
+}
+
+// validConditions checks the request conditions of the path mapping entry
+func (p *PathMappingEntry) validConditions() bool {
+	if p.Regex {
+		if p.Exact {
+			return false
+		}
+		if _, err := compilePattern(p.From); err != nil {
+			return false
+		}
+	}
+
+	for i := range p.Query {
+		if !p.Query[i].valid() {
+			return false
+		}
+	}
+
+	for i := range p.Headers {
+		if !p.Headers[i].valid() {
+			return false
+		}
+	}
+
+	for i := range p.Cookies {
+		if !p.Cookies[i].valid() {
+			return false
+		}
+	}
+
+	if p.UserAgent != "" {
+		if _, err := compilePattern(p.UserAgent); err != nil {
+			return false
+		}
+	}
+
+	switch p.Device {
+	case "", DeviceMobile, DeviceTablet, DeviceDesktop:
+	default:
+		return false
+	}
+
+	for _, l := range p.Languages {
+		if l == "" {
+			return false
+		}
+	}
+
+	for _, c := range p.Countries {
+		if len(c) != 2 {
+			return false
+		}
+	}
+
+	for _, c := range p.Continents {
+		if !continentCodes[strings.ToUpper(c)] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hasConditions checks for any structured condition
+func (p *PathMappingEntry) hasConditions() bool {
+	return len(p.Query) > 0 || len(p.Headers) > 0 || len(p.Cookies) > 0 ||
+		len(p.Languages) > 0 || p.UserAgent != "" || p.Device != "" ||
+		len(p.Countries) > 0 || len(p.Continents) > 0
+}
+
+// IsPlain checks for a prefix redirect rule without conditions and splits. Its From identifies the rule
+func (p *PathMappingEntry) IsPlain() bool {
+	return !p.Regex && !p.Exact && !p.hasConditions() && len(p.Targets) == 0 && !p.isResponse()
+}
+
+// pathMatches tests only the path of the path mapping entry against the request. It keeps
+// the captures of the rule currently evaluated
+func (p *PathMappingEntry) pathMatches(req *request) bool {
+	switch {
+	case p.Exact:
+		return req.matchPath == p.From || req.matchPath+"?"+req.rawQuery == p.From
+	case p.Regex:
+		re, err := p.pattern(req)
+		return err == nil && re.MatchString(req.path)
+	case !p.hasConditions():
+		return req.hasPrefix(p.From, true)
+	}
+
+	return req.hasPrefix(p.From, false)
+}
+
+// matches tests the path mapping entry against the request
+func (p *PathMappingEntry) matches(req *request) bool {
+	req.captures = nil
+
+	switch {
+	case p.Exact:
+		// the path or the path and the query string
+		if req.matchPath != p.From && req.matchPath+"?"+req.rawQuery != p.From {
+			return false
+		}
+	case p.Regex:
+		if !p.matchRegex(req) {
+			return false
+		}
+	case !p.hasConditions():
+		// legacy matching on the raw path and query string
+		return req.hasPrefix(p.From, true)
+	case !req.hasPrefix(p.From, false):
+		return false
+	}
+
+	for i := range p.Query {
+		if !p.Query[i].matches(req.query) {
+			return false
+		}
+	}
+
+	for i := range p.Headers {
+		if !p.Headers[i].matches(req.Header) {
+			return false
+		}
+	}
+
+	for i := range p.Cookies {
+		if !p.Cookies[i].matches(req.Request) {
+			return false
+		}
+	}
+
+	if p.UserAgent != "" {
+		re, err := compilePattern(p.UserAgent)
+		if err != nil || !re.MatchString(req.UserAgent()) {
+			return false
+		}
+	}
+
+	if p.Device != "" && p.Device != detectDevice(req.UserAgent()) {
+		return false
+	}
+
+	if len(p.Languages) > 0 && !matchLanguage(req.negotiatedLanguage(), p.Languages) {
+		return false
+	}
+
+	if len(p.Countries) > 0 || len(p.Continents) > 0 {
+		country, continent := req.location()
+		if len(p.Countries) > 0 && !matchCode(country, p.Countries) {
+			return false
+		}
+		if len(p.Continents) > 0 && !matchCode(continent, p.Continents) {
+			return false
+		}
+	}
+
+	return true
+}
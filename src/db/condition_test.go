@@ -0,0 +1,36 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+
+	"github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Pattern cache", func() {
+	ginkgo.It("Pattern cache is cleared when it is full", func() {
+		for i := 0; i <= maxPatternCache; i++ {
+			_, err := compilePattern(fmt.Sprintf("^/cache/%d$", i))
+			Expect(err).To(BeNil())
+		}
+
+		patternMutex.RLock()
+		defer patternMutex.RUnlock()
+		Expect(len(patternCache)).To(BeNumerically("<=", maxPatternCache))
+		Expect(patternCache).To(HaveKey(fmt.Sprintf("^/cache/%d$", maxPatternCache)))
+	})
+})
@@ -29,11 +29,16 @@ var (
 	dbDomainTableName = getOSPrefixEnv("DOMAINS")
 	dbCacheTableName  = getOSPrefixEnv("DOMAINS_TLS_CACHE")
 	dbUsersTable      = getOSPrefixEnv("USERS")
+	dbPathsTableName  = getOSPrefixEnv("PATHS")
 )
 
 var (
 	// DBTablePrefix holds the db prefix
 	DBTablePrefix = ""
+	// Geo resolves the client location for the geo conditions
+	Geo GeoLocator
+	// InactiveRedirect is the redirect target for domains outside their validity window
+	InactiveRedirect = ""
 )
 
 const (
@@ -131,6 +136,24 @@ func (d *DynamoDB) prepareTable() {
 	dbUsersTableDescribe := &dynamodb.DescribeTableInput{
 		TableName: aws.String(DBTablePrefix + dbUsersTable),
 	}
+	dbPathsTableCreate := &dynamodb.CreateTableInput{
+		TableName: aws.String(DBTablePrefix + dbPathsTableName),
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{AttributeName: aws.String("domain"), KeyType: aws.String("HASH")},
+			{AttributeName: aws.String("chunk"), KeyType: aws.String("RANGE")},
+		},
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{AttributeName: aws.String("domain"), AttributeType: aws.String("S")},
+			{AttributeName: aws.String("chunk"), AttributeType: aws.String("N")},
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(1),
+			WriteCapacityUnits: aws.Int64(1),
+		},
+	}
+	dbPathsTableDescribe := &dynamodb.DescribeTableInput{
+		TableName: aws.String(DBTablePrefix + dbPathsTableName),
+	}
 
 	// setup the domain table by spec
 	if _, err := d.Service.DescribeTable(dbDomainTableDescribe); err != nil {
@@ -159,4 +182,13 @@ func (d *DynamoDB) prepareTable() {
 		}
 		log.Info("Table 'SwerveUsers' created")
 	}
+	// setup the paths table by spec
+	if _, err := d.Service.DescribeTable(dbPathsTableDescribe); err != nil {
+		log.Error(err)
+		log.Info("Table 'DomainPaths' didn't exists. Creating ...")
+		if _, cerr := d.Service.CreateTable(dbPathsTableCreate); cerr != nil {
+			log.Fatal(cerr)
+		}
+		log.Info("Table 'DomainPaths' created")
+	}
 }
@@ -0,0 +1,142 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dbtest provides an in memory DynamoDB for the tests of the db users
+package dbtest
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// FakeDynamo keeps the items of the domains, paths and tls cache tables in memory. It supports
+// the expressions used by the db package only
+type FakeDynamo struct {
+	dynamodbiface.DynamoDBAPI
+	Items map[string]map[string]*dynamodb.AttributeValue
+	// BeforeWrite runs before a stored item is replaced or updated, e.g. to change it concurrently
+	BeforeWrite func(item map[string]*dynamodb.AttributeValue)
+}
+
+// NewFakeDynamo creates an empty instance
+func NewFakeDynamo() *FakeDynamo {
+	return &FakeDynamo{Items: map[string]map[string]*dynamodb.AttributeValue{}}
+}
+
+// key joins the table and the key attributes of the item
+func (f *FakeDynamo) key(table *string, item map[string]*dynamodb.AttributeValue) string {
+	key := *table
+	for _, name := range []string{"cacheKey", "domain"} {
+		if value, ok := item[name]; ok {
+			key += "/" + *value.S
+		}
+	}
+	if chunk, ok := item["chunk"]; ok {
+		key += "/" + *chunk.N
+	}
+	return key
+}
+
+// check evaluates the condition of a write against the stored item
+func (f *FakeDynamo) check(condition *string, item map[string]*dynamodb.AttributeValue, values map[string]*dynamodb.AttributeValue) error {
+	if condition == nil {
+		return nil
+	}
+
+	ok := false
+	switch *condition {
+	case "attribute_not_exists(#c)":
+		ok = item == nil
+	case "modified = :e":
+		ok = item != nil && item["modified"] != nil && *item["modified"].S == *values[":e"].S
+	}
+	if !ok {
+		return awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+	}
+
+	return nil
+}
+
+// GetItem returns the stored item
+func (f *FakeDynamo) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{Item: f.Items[f.key(input.TableName, input.Key)]}, nil
+}
+
+// PutItem stores the item and returns the replaced one
+func (f *FakeDynamo) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	key := f.key(input.TableName, input.Item)
+	old := f.Items[key]
+	if old != nil && f.BeforeWrite != nil {
+		f.BeforeWrite(old)
+	}
+	if err := f.check(input.ConditionExpression, old, input.ExpressionAttributeValues); err != nil {
+		return nil, err
+	}
+	f.Items[key] = input.Item
+
+	return &dynamodb.PutItemOutput{Attributes: old}, nil
+}
+
+// UpdateItem applies set expressions to the stored item
+func (f *FakeDynamo) UpdateItem(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+	item := f.Items[f.key(input.TableName, input.Key)]
+	if item != nil && f.BeforeWrite != nil {
+		f.BeforeWrite(item)
+	}
+	if err := f.check(input.ConditionExpression, item, input.ExpressionAttributeValues); err != nil {
+		return nil, err
+	}
+
+	for _, set := range strings.Split(strings.TrimPrefix(*input.UpdateExpression, "set "), ", ") {
+		parts := strings.Split(set, " = ")
+		item[parts[0]] = input.ExpressionAttributeValues[parts[1]]
+	}
+
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+// DeleteItem removes the item and returns it
+func (f *FakeDynamo) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	key := f.key(input.TableName, input.Key)
+	old := f.Items[key]
+	delete(f.Items, key)
+
+	return &dynamodb.DeleteItemOutput{Attributes: old}, nil
+}
+
+// Scan returns the items of the domains table
+func (f *FakeDynamo) Scan(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+	res := &dynamodb.ScanOutput{}
+	for _, item := range f.Items {
+		if item["domain"] != nil && item["chunk"] == nil {
+			res.Items = append(res.Items, item)
+		}
+	}
+
+	return res, nil
+}
+
+// ChunkCount returns the number of stored path chunks
+func (f *FakeDynamo) ChunkCount() int {
+	count := 0
+	for _, item := range f.Items {
+		if item["chunk"] != nil {
+			count++
+		}
+	}
+	return count
+}
@@ -15,100 +15,189 @@
 package db
 
 import (
-	"bytes"
-	"compress/gzip"
 	"encoding/base64"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"io/ioutil"
+	"net/http"
 	"net/url"
-	"path"
 	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/axelspringer/swerve/src/log"
 )
 
 // Validate the domain
-func (d *Domain) Validate() []error {
-	res := []error{}
+func (d *Domain) Validate() ValidationErrors {
+	res := ValidationErrors{}
 
 	if d.ID == "" {
-		res = append(res, errors.New("Invalid id"))
+		res.add("id", ValidationRequired, "Invalid id")
+	}
+
+	// store the canonical form of the name
+	name, hostErr := NormalizeHost(d.Name)
+	if hostErr == nil {
+		d.Name = name
+		d.DisplayName = DisplayHost(name)
 	}
 
 	validURL, err := url.Parse("//" + d.Name)
-	if d.Name == "" || err != nil || validURL.Path != "" {
-		res = append(res, errors.New("Invalid domain name"))
+	if d.Name == "" {
+		res.add("domain", ValidationRequired, "Invalid domain name")
+	} else if hostErr != nil || err != nil || validURL.Path != "" {
+		res.add("domain", ValidationInvalid, "Invalid domain name")
+	} else if !d.Wildcard && isPublicSuffix(d.Name) {
+		res.add("domain", ValidationPublicSuffix, "Invalid domain name %s is a public suffix", d.Name)
 	}
 
-	if d.Created == "" || d.Modified == "" {
-		res = append(res, errors.New("Invalid domain date"))
+	// store the rules in the normalized form of the domain
+	d.normalizePaths()
+
+	if !d.validWildcard() {
+		res.add("wildcard", ValidationInvalid, "Invalid wildcard domain")
 	}
 
-	if d.Redirect == "" {
-		res = append(res, errors.New("Invalid domain redirect target"))
+	for _, alias := range d.normalizeAliases() {
+		res.add("aliases", ValidationInvalid, "Invalid alias %s", alias)
 	}
 
-	if d.RedirectCode < 300 || d.RedirectCode > 399 {
-		res = append(res, errors.New("Invalid redirect http status code"))
+	for _, alias := range d.Aliases {
+		if isPublicSuffix(alias) {
+			res.add("aliases", ValidationPublicSuffix, "Invalid alias %s is a public suffix", alias)
+		}
 	}
 
-	return res
-}
+	for _, alias := range d.duplicateAliases() {
+		res.add("aliases", ValidationDuplicate, "Duplicate alias %s", alias)
+	}
 
-// GetRedirect returns calculated routes
-func (d *Domain) GetRedirect(reqURL *url.URL) (string, int) {
-	code := d.RedirectCode
-	reURL := d.Redirect
-	rePath := ""
-	reQuery := ""
-	reqPath := reqURL.EscapedPath()
-	reqQuery := reqURL.RawQuery
+	if d.Created == "" || d.Modified == "" {
+		res.add("created", ValidationRequired, "Invalid domain date")
+	}
 
-	if d.Promotable == true {
-		rePath = reqURL.Path
+	if !d.validAction() {
+		res.add("action", ValidationInvalid, "Invalid domain action")
+	} else if d.Action == ActionProxy {
+		if !d.Proxy.valid() {
+			res.add("proxy", ValidationInvalid, "Invalid domain proxy")
+		}
+	} else if d.isResponse() {
+		if !d.validResponse() {
+			res.add("status", ValidationInvalid, "Invalid domain response status code")
+		}
+	} else {
+		if d.Redirect == "" {
+			res.add("redirect", ValidationRequired, "Invalid domain redirect target")
+		} else if !validTarget(d.Redirect, false) {
+			res.add("redirect", ValidationInvalid, "Invalid domain redirect target")
+		} else if !validTemplate(d.Redirect, nil) {
+			res.add("redirect", ValidationInvalid, "Invalid domain redirect template")
+		}
 
-		if len(reqURL.RawQuery) > 0 {
-			reQuery = "?" + reqURL.RawQuery
+		if !isRedirectCode(d.RedirectCode) {
+			res.add("code", ValidationInvalid, "Invalid redirect http status code")
 		}
 	}
 
-	if d.PathMapping != nil && len(*d.PathMapping) > 0 {
-		for _, p := range *d.PathMapping {
-			// skip empty path mapping
-			if p.To == "" {
-				continue
+	if len(d.Targets) > 0 {
+		if !validTargets(d.Targets, nil, false) {
+			res.add("targets", ValidationInvalid, "Invalid domain split targets")
+		}
+		if !isTemporaryRedirectCode(d.RedirectCode) {
+			res.add("code", ValidationInvalid, "Invalid redirect http status code for a split")
+		}
+	}
+
+	if d.HSTS != nil && !d.HSTS.valid() {
+		res.add("hsts", ValidationInvalid, "Invalid hsts settings")
+	}
+
+	if d.NotFound != nil && !d.NotFound.validNotFound() {
+		res.add("not_found", ValidationInvalid, "Invalid domain not found response")
+	}
+
+	if !validWindow(d.ValidFrom, d.ValidUntil) {
+		res.add("valid_until", ValidationInvalid, "Invalid domain validity window")
+	}
+
+	if d.QueryPolicy != nil && !d.QueryPolicy.valid() {
+		res.add("query_policy", ValidationInvalid, "Invalid query policy")
+	}
+
+	if d.ResponseHeaders != nil && !d.ResponseHeaders.valid() {
+		res.add("response_headers", ValidationInvalid, "Invalid response headers")
+	}
+
+	if d.PathMapping != nil {
+		for i, p := range *d.PathMapping {
+			if p.From == "" {
+				res.add(pathField(i, "from"), ValidationRequired, "Empty from on path %d", i)
+			} else if !p.Regex && !strings.HasPrefix(p.From, "/") {
+				res.add(pathField(i, "from"), ValidationInvalid, "Invalid from on path %s", p.From)
+			}
+			if !p.validAction() {
+				res.add(pathField(i, "action"), ValidationInvalid, "Invalid action on path %s", p.From)
+			} else if p.Action == ActionProxy {
+				if !p.Proxy.valid() {
+					res.add(pathField(i, "proxy"), ValidationInvalid, "Invalid proxy on path %s", p.From)
+				}
+			} else if p.isResponse() && !p.validResponse() {
+				res.add(pathField(i, "status"), ValidationInvalid, "Invalid response status code on path %s", p.From)
+			}
+			if !p.validConditions() {
+				res.add(pathField(i, ""), ValidationInvalid, "Invalid condition on path %s", p.From)
 			}
-			// we match the path prefix
-			if strings.HasPrefix(reqPath+"?"+reqQuery, p.From) {
-				if strings.HasPrefix(reqPath, p.From) {
-					rePath = reqPath[len(p.From):]
-				} else {
-					rePath = p.From
+			if p.To != "" && !validTarget(p.To, true) {
+				res.add(pathField(i, "to"), ValidationInvalid, "Invalid redirect target on path %s", p.From)
+			} else if !p.validTemplate() {
+				res.add(pathField(i, "to"), ValidationInvalid, "Invalid redirect template on path %s", p.From)
+			}
+			if p.Code != 0 && !isRedirectCode(p.Code) {
+				res.add(pathField(i, "code"), ValidationInvalid, "Invalid redirect http status code on path %s", p.From)
+			}
+			if len(p.Targets) > 0 {
+				if !validTargets(p.Targets, p.captures(), true) {
+					res.add(pathField(i, "targets"), ValidationInvalid, "Invalid split targets on path %s", p.From)
 				}
-				// path redirect
-				if strings.HasPrefix(p.To, "http://") || strings.HasPrefix(p.To, "https://") {
-					reURL = p.To
-				} else {
-					if d.Promotable {
-						rePath = path.Join(p.To, rePath)
-					} else {
-						rePath = p.To
-					}
+				code := d.RedirectCode
+				if p.Code != 0 {
+					code = p.Code
 				}
-				break
+				if !isTemporaryRedirectCode(code) {
+					res.add(pathField(i, "code"), ValidationInvalid, "Invalid redirect http status code for the split on path %s", p.From)
+				}
+			}
+			if !validWindow(p.ValidFrom, p.ValidUntil) {
+				res.add(pathField(i, "valid_until"), ValidationInvalid, "Invalid validity window on path %s", p.From)
 			}
+			if p.QueryPolicy != nil && !p.QueryPolicy.valid() {
+				res.add(pathField(i, "query_policy"), ValidationInvalid, "Invalid query policy on path %s", p.From)
+			}
+			if p.ResponseHeaders != nil && !p.ResponseHeaders.valid() {
+				res.add(pathField(i, "response_headers"), ValidationInvalid, "Invalid response headers on path %s", p.From)
+			}
+		}
+
+		for _, i := range d.duplicatePaths() {
+			res.add(pathField(i, "from"), ValidationDuplicate, "Duplicate path %s", (*d.PathMapping)[i].From)
 		}
 	}
 
-	if strings.HasSuffix(reURL, "/") && strings.HasPrefix(rePath, "/") {
-		rePath = strings.TrimLeft(rePath, "/")
+	return res
+}
+
+// isRedirectCode checks the code against the allowed redirect codes. 300, 304 and 305
+// don't redirect browsers to the location
+func isRedirectCode(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
 	}
 
-	return reURL + rePath + reQuery, code
+	return false
 }
 
 // UpdateCertificateData updates the cert data if a domain entry exist
@@ -140,14 +229,26 @@ func (d *DynamoDB) DeleteByDomain(domain string) (bool, error) {
 				S: aws.String(domain),
 			},
 		},
-		TableName: aws.String(DBTablePrefix + dbDomainTableName),
+		TableName:    aws.String(DBTablePrefix + dbDomainTableName),
+		ReturnValues: aws.String(dynamodb.ReturnValueAllOld),
 	})
+	if err != nil {
+		return false, err
+	}
+
+	// only domains with chunks need the paths table
+	deleted := DomainDB{}
+	if err := dynamodbattribute.UnmarshalMap(out.Attributes, &deleted); err != nil {
+		log.Errorf("Error while reading the deleted domain %s. %v", domain, err)
+	} else if len(deleted.PathChunks) > 0 {
+		d.discardPathChunks(domain, deleted.chunkKeys())
+	}
 
-	return out != nil && err == nil, err
+	return out != nil, nil
 }
 
-// FetchByDomain items from domains table
-func (d *DynamoDB) FetchByDomain(domain string) (*Domain, error) {
+// fetchDomainDB returns the stored domain item without the path rules of the paths table
+func (d *DynamoDB) fetchDomainDB(domain string) (*DomainDB, error) {
 	res, err := d.Service.GetItem(&dynamodb.GetItemInput{
 		TableName: aws.String(DBTablePrefix + dbDomainTableName),
 		Key: map[string]*dynamodb.AttributeValue{
@@ -165,6 +266,41 @@ func (d *DynamoDB) FetchByDomain(domain string) (*Domain, error) {
 		return nil, err
 	}
 
+	return domainDBRes, nil
+}
+
+// DomainExists checks for a stored domain with the name without reading its path rules
+func (d *DynamoDB) DomainExists(domain string) (bool, error) {
+	res, err := d.Service.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(DBTablePrefix + dbDomainTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"domain": {
+				S: aws.String(domain),
+			},
+		},
+		ProjectionExpression: aws.String("#d"),
+		ExpressionAttributeNames: map[string]*string{
+			"#d": aws.String("domain"),
+		},
+	})
+	if err != nil {
+		return false, fmt.Errorf("Error while getting item. %v", err)
+	}
+
+	return res.Item != nil, nil
+}
+
+// FetchByDomain items from domains table
+func (d *DynamoDB) FetchByDomain(domain string) (*Domain, error) {
+	domainDBRes, err := d.fetchDomainDB(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = d.loadPathChunks(domainDBRes); err != nil {
+		return nil, err
+	}
+
 	domainRes, err := domainDBRes.toDomain()
 	if err != nil {
 		return nil, err
@@ -173,14 +309,15 @@ func (d *DynamoDB) FetchByDomain(domain string) (*Domain, error) {
 	return &domainRes, nil
 }
 
-// FetchAllSorted returns all items from table with a sorted paths (important for the redirects!)
+// FetchAllSorted returns all items from table with a sorted and compiled paths (important for the redirects!)
 func (d *DynamoDB) FetchAllSorted() ([]Domain, error) {
 	domains, err := d.FetchAll()
 	if err != nil {
 		return nil, err
 	}
-	for _, domain := range domains {
-		domain.sortPathMap()
+	for i := range domains {
+		domains[i].sortPathMap()
+		domains[i].Compile()
 	}
 	return domains, nil
 }
@@ -203,8 +340,11 @@ func (d *DynamoDB) FetchAll() ([]Domain, error) {
 		return nil, fmt.Errorf("Failed to unmarshal Dynamodb Scan Items, %v", err)
 	}
 
-	for _, domaindb := range recs {
-		domain, err := domaindb.toDomain()
+	for i := range recs {
+		if err := d.loadPathChunks(&recs[i]); err != nil {
+			return nil, err
+		}
+		domain, err := recs[i].toDomain()
 		if err != nil {
 			return nil, err
 		}
@@ -253,8 +393,11 @@ func (d *DynamoDB) FetchAllPaginated(cursor *string) ([]Domain, *string, error)
 		newCursor = "EOF"
 	}
 
-	for _, domaindb := range recs {
-		domain, err := domaindb.toDomain()
+	for i := range recs {
+		if err := d.loadPathChunks(&recs[i]); err != nil {
+			return nil, nil, err
+		}
+		domain, err := recs[i].toDomain()
 		if err != nil {
 			return nil, nil, err
 		}
@@ -264,24 +407,61 @@ func (d *DynamoDB) FetchAllPaginated(cursor *string) ([]Domain, *string, error)
 	return domains, &newCursor, nil
 }
 
-// InsertDomain stores a domain
+// InsertDomain stores a domain. Large path maps are stored in chunks in the paths table
 func (d *DynamoDB) InsertDomain(domain Domain) error {
-	domaindb, err := domain.toDomainDB()
+	return d.insertDomain(domain, "")
+}
+
+// UpdateDomain stores the domain still modified at the given date. Otherwise the write fails with ErrConflict
+func (d *DynamoDB) UpdateDomain(domain Domain, modified string) error {
+	return d.insertDomain(domain, modified)
+}
+
+// insertDomain stores the domain. With a modification date the stored domain has to be still
+// modified at it, otherwise the write fails with ErrConflict. The chunks are stored under new
+// keys first, so the domain item switches to the new path map in a single write
+func (d *DynamoDB) insertDomain(domain Domain, modified string) error {
+	domaindb, chunks, err := domain.toDomainDB()
+	if err != nil {
+		return err
+	}
+
+	domaindb.PathChunkKeys, err = d.putPathChunks(domain.Name, chunks)
 	if err != nil {
 		return err
 	}
 
 	mm, err := dynamodbattribute.MarshalMap(domaindb)
 	if err != nil {
+		d.discardPathChunks(domain.Name, domaindb.PathChunkKeys)
 		return err
 	}
 
-	_, err = d.Service.PutItem(&dynamodb.PutItemInput{
-		Item:      mm,
-		TableName: aws.String(DBTablePrefix + dbDomainTableName),
-	})
+	input := &dynamodb.PutItemInput{
+		Item:         mm,
+		TableName:    aws.String(DBTablePrefix + dbDomainTableName),
+		ReturnValues: aws.String(dynamodb.ReturnValueAllOld),
+	}
+	if modified != "" {
+		input.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{}
+		input.ConditionExpression = modifiedCondition(modified, input.ExpressionAttributeValues)
+	}
 
-	return err
+	out, err := d.Service.PutItem(input)
+	if err != nil {
+		d.discardPathChunks(domain.Name, domaindb.PathChunkKeys)
+		return conditionError(err)
+	}
+
+	// remove the chunks of the replaced domain item
+	replaced := DomainDB{}
+	if err := dynamodbattribute.UnmarshalMap(out.Attributes, &replaced); err != nil {
+		log.Errorf("Error while reading the replaced domain %s. %v", domain.Name, err)
+		return nil
+	}
+	d.discardPathChunks(domain.Name, replaced.chunkKeys())
+
+	return nil
 }
 
 // DeleteAllDomains deletes all items from the domains table
@@ -305,76 +485,48 @@ func (d *DynamoDB) DeleteAllDomains() error {
 // Import imports a export set
 func (d *DynamoDB) Import(e *ExportDomains) error {
 	for _, do := range e.Domains {
-		ddb, err := do.toDomainDB()
-		if err != nil {
-			return err
-		}
-
-		mm, err := dynamodbattribute.MarshalMap(ddb)
-
-		if err != nil {
+		if err := d.InsertDomain(do); err != nil {
 			return err
 		}
-
-		_, err = d.Service.PutItem(&dynamodb.PutItemInput{
-			Item:      mm,
-			TableName: aws.String(DBTablePrefix + dbDomainTableName),
-		})
 	}
 
 	return nil
 }
 
-func (d *Domain) toDomainDB() (DomainDB, error) {
-	var buf bytes.Buffer
+func (d *Domain) toDomainDB() (DomainDB, []PathList, error) {
 	domaindb := DomainDB{
 		Domain: *d,
 	}
 
-	pm, _ := json.Marshal(d.PathMapping)
-	if len(pm) > 200000 {
-		domaindb.PathMapping = nil
-		writer := gzip.NewWriter(&buf)
-		if _, err := writer.Write(pm); err != nil {
-			return domaindb, err
-		}
-		if err := writer.Flush(); err != nil {
-			return domaindb, err
-		}
+	pm, err := json.Marshal(d.PathMapping)
+	if err != nil {
+		return domaindb, nil, err
+	}
+	if len(pm) <= maxInlinePathSize {
+		return domaindb, nil, nil
+	}
 
-		if err := writer.Close(); err != nil {
-			return domaindb, err
-		}
+	chunks, err := chunkPaths(*d.PathMapping)
+	if err != nil {
+		return domaindb, nil, err
+	}
 
-		bytes := buf.Bytes()
-		domaindb.BinPathMapping = &bytes
+	domaindb.PathMapping = nil
+	for _, chunk := range chunks {
+		domaindb.PathChunks = append(domaindb.PathChunks, len(chunk))
 	}
 
-	return domaindb, nil
+	return domaindb, chunks, nil
 }
 
 func (d *DomainDB) toDomain() (Domain, error) {
 	var pl PathList
 	domain := d.Domain
+	domain.DisplayName = DisplayHost(domain.Name)
 
+	// path maps gzipped into the domain item by former versions
 	if domain.PathMapping == nil && d.BinPathMapping != nil {
-		b := bytes.NewBuffer(*d.BinPathMapping)
-		reader, err := gzip.NewReader(b)
-		if err != nil {
-			return domain, err
-		}
-
-		s, err := ioutil.ReadAll(reader)
-		if err != nil {
-			return domain, err
-		}
-
-		if err := reader.Close(); err != nil {
-			return domain, err
-		}
-
-		err = json.Unmarshal(s, &pl)
-		if err != nil {
+		if err := gunzipJSON(*d.BinPathMapping, &pl); err != nil {
 			return domain, err
 		}
 
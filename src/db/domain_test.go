@@ -2,8 +2,12 @@ package db_test
 
 import (
 	"errors"
+	"net"
+	"net/http"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/axelspringer/swerve/src/db"
 
@@ -11,6 +15,13 @@ import (
 	. "github.com/onsi/gomega"
 )
 
+type fakeLocator map[string][2]string
+
+func (f fakeLocator) Lookup(ip net.IP) (string, string) {
+	location := f[ip.String()]
+	return location[0], location[1]
+}
+
 func TestDBDomain(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "DB domain suite")
@@ -19,16 +30,45 @@ func TestDBDomain(t *testing.T) {
 var _ = Describe("type Domain", func() {
 	It("Domain struct validating", func() {
 		domain := &db.Domain{}
-		errList := domain.Validate()
-		Expect(errList).To(Equal([]error{
-			errors.New("Invalid id"),
-			errors.New("Invalid domain name"),
-			errors.New("Invalid domain date"),
-			errors.New("Invalid domain redirect target"),
-			errors.New("Invalid redirect http status code"),
+		errList := domain.Validate().Messages()
+		Expect(errList).To(Equal([]string{
+			"Invalid id",
+			"Invalid domain name",
+			"Invalid domain date",
+			"Invalid domain redirect target",
+			"Invalid redirect http status code",
 		}))
 	})
 
+	It("Domain struct validating wildcards", func() {
+		domain := &db.Domain{
+			ID:           "1",
+			Created:      "now",
+			Modified:     "now",
+			Redirect:     "https://www.example.com",
+			RedirectCode: 301,
+		}
+
+		for name, wildcard := range map[string]bool{"*.brand.com": true, "*.shop.brand.co.uk": true, "www.brand.com": false} {
+			domain.Name = name
+			domain.Wildcard = wildcard
+			Expect(domain.Validate()).To(BeEmpty(), name)
+		}
+
+		for name, wildcard := range map[string]bool{
+			"*.com":          true,
+			"*.co.uk":        true,
+			"*.*.brand.com":  true,
+			"www*.brand.com": true,
+			"brand.com":      true,
+			"*.brand.com":    false,
+		} {
+			domain.Name = name
+			domain.Wildcard = wildcard
+			Expect(domain.Validate().Messages()).To(ContainElement("Invalid wildcard domain"), name)
+		}
+	})
+
 	Context("type Domain struct", func() {
 		It("Domain struct redirect", func() {
 			domain := &db.Domain{
@@ -40,7 +80,7 @@ var _ = Describe("type Domain", func() {
 			url, err := url.Parse("https://example.com/path/to/promote?with=query")
 			Expect(err).To(BeNil())
 
-			redirectURL, redirectCode := domain.GetRedirect(url)
+			redirectURL, redirectCode := domain.GetRedirect(&http.Request{URL: url})
 			Expect("https://www.example.com").To(Equal(redirectURL))
 			Expect(redirectCode).To(Equal(301))
 		})
@@ -56,7 +96,7 @@ var _ = Describe("type Domain", func() {
 			url, err := url.Parse("https://example.com/path/to/promote?with=query")
 			Expect(err).To(BeNil())
 
-			redirectURL, redirectCode := domain.GetRedirect(url)
+			redirectURL, redirectCode := domain.GetRedirect(&http.Request{URL: url})
 			Expect("https://www.example.com/").To(Equal(redirectURL))
 			Expect(redirectCode).To(Equal(301))
 		})
@@ -72,7 +112,7 @@ var _ = Describe("type Domain", func() {
 			url, err := url.Parse("https://example.com/path/to/promote/")
 			Expect(err).To(BeNil())
 
-			redirectURL, redirectCode := domain.GetRedirect(url)
+			redirectURL, redirectCode := domain.GetRedirect(&http.Request{URL: url})
 			Expect("https://www.example.com/path/to/promote/").To(Equal(redirectURL))
 			Expect(redirectCode).To(Equal(301))
 		})
@@ -88,7 +128,7 @@ var _ = Describe("type Domain", func() {
 			url, err := url.Parse("https://example.com/path/to/promote/")
 			Expect(err).To(BeNil())
 
-			redirectURL, redirectCode := domain.GetRedirect(url)
+			redirectURL, redirectCode := domain.GetRedirect(&http.Request{URL: url})
 			Expect("https://www.example.com/path/to/promote/").To(Equal(redirectURL))
 			Expect(redirectCode).To(Equal(301))
 		})
@@ -104,7 +144,7 @@ var _ = Describe("type Domain", func() {
 			url, err := url.Parse("https://example.com/path/to/promote?with=query")
 			Expect(err).To(BeNil())
 
-			redirectURL, redirectCode := domain.GetRedirect(url)
+			redirectURL, redirectCode := domain.GetRedirect(&http.Request{URL: url})
 			Expect("https://www.example.com/path/to/promote?with=query").To(Equal(redirectURL))
 			Expect(redirectCode).To(Equal(301))
 		})
@@ -122,13 +162,13 @@ var _ = Describe("type Domain", func() {
 
 			url, err := url.Parse("https://example.com/path/to/promote?with=query")
 			Expect(err).To(BeNil())
-			redirectURL, redirectCode := domain.GetRedirect(url)
+			redirectURL, redirectCode := domain.GetRedirect(&http.Request{URL: url})
 			Expect("https://www.example.com/path/to/promote?with=query").To(Equal(redirectURL))
 			Expect(redirectCode).To(Equal(301))
 
 			url, err = url.Parse("https://example.com/old/path/to/promote?with=query")
 			Expect(err).To(BeNil())
-			redirectURL, redirectCode = domain.GetRedirect(url)
+			redirectURL, redirectCode = domain.GetRedirect(&http.Request{URL: url})
 			Expect("https://www.example.com/new/target/to/promote?with=query").To(Equal(redirectURL))
 			Expect(redirectCode).To(Equal(301))
 
@@ -136,7 +176,7 @@ var _ = Describe("type Domain", func() {
 			mapping[0].To = "https://theotherserver.com/new/target/"
 			url, err = url.Parse("https://example.com/old/path/to/promote?with=query")
 			Expect(err).To(BeNil())
-			redirectURL, redirectCode = domain.GetRedirect(url)
+			redirectURL, redirectCode = domain.GetRedirect(&http.Request{URL: url})
 			Expect("https://theotherserver.com/new/target/to/promote?with=query").To(Equal(redirectURL))
 			Expect(redirectCode).To(Equal(301))
 
@@ -154,13 +194,13 @@ var _ = Describe("type Domain", func() {
 
 			url, err := url.Parse("https://example.com/path/to/promote?with=query")
 			Expect(err).To(BeNil())
-			redirectURL, redirectCode := domain.GetRedirect(url)
+			redirectURL, redirectCode := domain.GetRedirect(&http.Request{URL: url})
 			Expect("https://www.example.com/").To(Equal(redirectURL))
 			Expect(redirectCode).To(Equal(301))
 
 			url, err = url.Parse("https://example.com/old/path/to/promote?with=query")
 			Expect(err).To(BeNil())
-			redirectURL, redirectCode = domain.GetRedirect(url)
+			redirectURL, redirectCode = domain.GetRedirect(&http.Request{URL: url})
 			Expect("https://www.example.com/new/target").To(Equal(redirectURL))
 			Expect(redirectCode).To(Equal(301))
 
@@ -168,9 +208,965 @@ var _ = Describe("type Domain", func() {
 			mapping[0].To = "https://theotherserver.com/new/target/"
 			url, err = url.Parse("https://example.com/old/path/to/promote?with=query")
 			Expect(err).To(BeNil())
-			redirectURL, redirectCode = domain.GetRedirect(url)
+			redirectURL, redirectCode = domain.GetRedirect(&http.Request{URL: url})
 			Expect("https://theotherserver.com/new/target/to/promote").To(Equal(redirectURL))
 			Expect(redirectCode).To(Equal(301))
 		})
+
+		It("Domain struct redirect path mapping with query conditions", func() {
+			domain := &db.Domain{
+				Name:         "example.com",
+				Redirect:     "https://www.example.com",
+				RedirectCode: 301,
+				Promotable:   false,
+				PathMapping: &db.PathList{
+					db.PathMappingEntry{From: "/index.php", To: "/page/42", Query: []db.QueryCondition{
+						{Param: "page", Match: db.MatchEquals, Value: "42"},
+						{Param: "lang"},
+					}},
+					db.PathMappingEntry{From: "/index.php", To: "/archive", Query: []db.QueryCondition{
+						{Param: "page", Match: db.MatchMatches, Value: "^[0-9]+$"},
+					}},
+				},
+			}
+
+			url, err := url.Parse("https://example.com/index.php?page=42&lang=de")
+			Expect(err).To(BeNil())
+			redirectURL, _ := domain.GetRedirect(&http.Request{URL: url})
+			Expect("https://www.example.com/page/42").To(Equal(redirectURL))
+
+			url, err = url.Parse("https://example.com/index.php?lang=de&page=42")
+			Expect(err).To(BeNil())
+			redirectURL, _ = domain.GetRedirect(&http.Request{URL: url})
+			Expect("https://www.example.com/page/42").To(Equal(redirectURL))
+
+			url, err = url.Parse("https://example.com/index.php?page=42")
+			Expect(err).To(BeNil())
+			redirectURL, _ = domain.GetRedirect(&http.Request{URL: url})
+			Expect("https://www.example.com/archive").To(Equal(redirectURL))
+
+			url, err = url.Parse("https://example.com/index.php?page=abc")
+			Expect(err).To(BeNil())
+			redirectURL, _ = domain.GetRedirect(&http.Request{URL: url})
+			Expect("https://www.example.com").To(Equal(redirectURL))
+		})
+
+		It("Domain struct validating query conditions", func() {
+			domain := &db.Domain{
+				ID:           "1",
+				Name:         "example.com",
+				Created:      "now",
+				Modified:     "now",
+				Redirect:     "https://www.example.com",
+				RedirectCode: 301,
+				PathMapping: &db.PathList{
+					db.PathMappingEntry{From: "/a", To: "/b", Query: []db.QueryCondition{{Param: "id", Match: db.MatchMatches, Value: "("}}},
+					db.PathMappingEntry{From: "/c", To: "/d", Query: []db.QueryCondition{{Param: "id", Match: "unknown"}}},
+				},
+			}
+			Expect(domain.Validate()).To(HaveLen(2))
+		})
+
+		It("Domain struct redirect with query policies", func() {
+			domain := &db.Domain{
+				Name:         "example.com",
+				Redirect:     "https://www.example.com",
+				RedirectCode: 301,
+				Promotable:   true,
+				QueryPolicy: &db.QueryPolicy{
+					Mode:   db.QueryDenylist,
+					Params: []string{"fbclid", "gclid"},
+					Rename: map[string]string{"camp": "utm_campaign"},
+					Set:    map[string]string{"utm_source": "swerve"},
+				},
+				PathMapping: &db.PathList{
+					db.PathMappingEntry{From: "/shop", To: "https://shop.example.com/", QueryPolicy: &db.QueryPolicy{
+						Mode:   db.QueryAllowlist,
+						Params: []string{"sku"},
+					}},
+					db.PathMappingEntry{From: "/plain", To: "https://www.example.com/plain?ref=legacy", QueryPolicy: &db.QueryPolicy{Mode: db.QueryDrop}},
+				},
+			}
+
+			url, err := url.Parse("https://example.com/landing?camp=spring&fbclid=abc&page=2")
+			Expect(err).To(BeNil())
+			redirectURL, _ := domain.GetRedirect(&http.Request{URL: url})
+			Expect("https://www.example.com/landing?page=2&utm_campaign=spring&utm_source=swerve").To(Equal(redirectURL))
+
+			url, err = url.Parse("https://example.com/shop/item?sku=42&gclid=abc")
+			Expect(err).To(BeNil())
+			redirectURL, _ = domain.GetRedirect(&http.Request{URL: url})
+			Expect("https://shop.example.com/item?sku=42").To(Equal(redirectURL))
+
+			url, err = url.Parse("https://example.com/plain?sku=42")
+			Expect(err).To(BeNil())
+			redirectURL, _ = domain.GetRedirect(&http.Request{URL: url})
+			Expect("https://www.example.com/plain?ref=legacy").To(Equal(redirectURL))
+		})
+
+		It("Domain struct redirect path mapping with rule code", func() {
+			domain := &db.Domain{
+				Name:         "example.com",
+				Redirect:     "https://www.example.com",
+				RedirectCode: 301,
+				PathMapping: &db.PathList{
+					db.PathMappingEntry{From: "/old-campaign", To: "/campaign", Code: 302},
+				},
+			}
+
+			url, err := url.Parse("https://example.com/old-campaign")
+			Expect(err).To(BeNil())
+			redirectURL, redirectCode := domain.GetRedirect(&http.Request{URL: url})
+			Expect("https://www.example.com/campaign").To(Equal(redirectURL))
+			Expect(redirectCode).To(Equal(302))
+
+			url, err = url.Parse("https://example.com/other")
+			Expect(err).To(BeNil())
+			_, redirectCode = domain.GetRedirect(&http.Request{URL: url})
+			Expect(redirectCode).To(Equal(301))
+
+			mapping := *domain.PathMapping
+			mapping[0].Code = 304
+			domain.ID = "1"
+			domain.Created = "now"
+			domain.Modified = "now"
+			Expect(domain.Validate().Messages()).To(Equal([]string{
+				"Invalid redirect http status code on path /old-campaign",
+			}))
+		})
+
+		It("Domain struct redirect with request header conditions", func() {
+			domain := &db.Domain{
+				Name:         "example.com",
+				Redirect:     "https://www.example.com",
+				RedirectCode: 302,
+				PathMapping: &db.PathList{
+					db.PathMappingEntry{From: "/shop", To: "/shop/fr/", Languages: []string{"fr"}},
+					db.PathMappingEntry{From: "/", To: "https://apps.example.com/store", Device: db.DeviceMobile},
+					db.PathMappingEntry{From: "/", To: "/beta/", Cookies: []db.CookieCondition{{Cookie: "beta", Match: db.MatchEquals, Value: "1"}}},
+					db.PathMappingEntry{From: "/", To: "/bot/", UserAgent: "(?i)googlebot"},
+					db.PathMappingEntry{From: "/", To: "/de/", Languages: []string{"de"}},
+					db.PathMappingEntry{From: "/", To: "/en/", Languages: []string{"en"}},
+				},
+			}
+
+			newRequest := func(header http.Header) *http.Request {
+				url, err := url.Parse("https://example.com/")
+				Expect(err).To(BeNil())
+				return &http.Request{URL: url, Header: header}
+			}
+
+			redirectURL, _ := domain.GetRedirect(newRequest(http.Header{"Accept-Language": {"fr-CH, de-AT;q=0.9, en;q=0.8"}}))
+			Expect("https://www.example.com/de/").To(Equal(redirectURL))
+
+			redirectURL, _ = domain.GetRedirect(newRequest(http.Header{"Accept-Language": {"en-US,en;q=0.9,de;q=0.5"}}))
+			Expect("https://www.example.com/en/").To(Equal(redirectURL))
+
+			redirectURL, _ = domain.GetRedirect(newRequest(http.Header{"Accept-Language": {"fr"}}))
+			Expect("https://www.example.com").To(Equal(redirectURL))
+
+			// languages offered on other paths don't take part in the negotiation
+			redirectURL, _ = domain.GetRedirect(newRequest(http.Header{"Accept-Language": {"fr, de;q=0.8"}}))
+			Expect("https://www.example.com/de/").To(Equal(redirectURL))
+
+			shop, err := url.Parse("https://example.com/shop")
+			Expect(err).To(BeNil())
+			redirectURL, _ = domain.GetRedirect(&http.Request{URL: shop, Header: http.Header{"Accept-Language": {"fr, de;q=0.8"}}})
+			Expect("https://www.example.com/shop/fr/").To(Equal(redirectURL))
+
+			redirectURL, _ = domain.GetRedirect(newRequest(http.Header{
+				"User-Agent": {"Mozilla/5.0 (iPhone; CPU iPhone OS 12_0 like Mac OS X) Mobile/15E148"},
+			}))
+			Expect("https://apps.example.com/store").To(Equal(redirectURL))
+
+			redirectURL, _ = domain.GetRedirect(newRequest(http.Header{
+				"Cookie":          {"beta=1"},
+				"Accept-Language": {"de"},
+			}))
+			Expect("https://www.example.com/beta/").To(Equal(redirectURL))
+
+			redirectURL, _ = domain.GetRedirect(newRequest(http.Header{"User-Agent": {"Mozilla/5.0 (compatible; Googlebot/2.1)"}}))
+			Expect("https://www.example.com/bot/").To(Equal(redirectURL))
+		})
+
+		It("Domain struct redirect with geo conditions", func() {
+			db.Geo = fakeLocator{
+				"192.0.2.1": {"FR", "EU"},
+				"192.0.2.2": {"AT", "EU"},
+				"192.0.2.3": {"US", "NA"},
+			}
+			defer func() { db.Geo = nil }()
+
+			domain := &db.Domain{
+				Name:         "example.com",
+				Redirect:     "https://www.example.com",
+				RedirectCode: 302,
+				PathMapping: &db.PathList{
+					db.PathMappingEntry{From: "/", To: "https://example.fr/", Countries: []string{"FR"}},
+					db.PathMappingEntry{From: "/", To: "https://example.eu/", Continents: []string{"eu"}},
+				},
+			}
+
+			url, err := url.Parse("https://example.com/")
+			Expect(err).To(BeNil())
+
+			redirectURL, _ := domain.GetRedirect(&http.Request{URL: url, RemoteAddr: "192.0.2.1:4711"})
+			Expect("https://example.fr/").To(Equal(redirectURL))
+
+			redirectURL, _ = domain.GetRedirect(&http.Request{URL: url, RemoteAddr: "192.0.2.2:4711"})
+			Expect("https://example.eu/").To(Equal(redirectURL))
+
+			redirectURL, _ = domain.GetRedirect(&http.Request{URL: url, RemoteAddr: "192.0.2.3:4711"})
+			Expect("https://www.example.com").To(Equal(redirectURL))
+		})
+
+		It("Domain struct redirect with templated targets", func() {
+			domain := &db.Domain{
+				Name:         "*.brand.com",
+				Wildcard:     true,
+				Redirect:     "https://{subdomain}.newbrand.com{path}",
+				RedirectCode: 301,
+				Promotable:   true,
+				PathMapping: &db.PathList{
+					db.PathMappingEntry{From: `^/product/(?P<sku>[0-9]+)/([a-z]+)`, Regex: true, To: "https://shop.example.com/{2}?sku={sku}&ref={host}"},
+					db.PathMappingEntry{From: "/legacy", To: "/{label1}/archive?q={query}"},
+					db.PathMappingEntry{From: "/plain", To: "/plain"},
+				},
+			}
+
+			newRequest := func(target string) *http.Request {
+				url, err := url.Parse(target)
+				Expect(err).To(BeNil())
+				return &http.Request{URL: url, Host: url.Host}
+			}
+
+			redirectURL, _ := domain.GetRedirect(newRequest("http://de.shop.brand.com:8080/some%20path?a=1"))
+			Expect("https://de.shop.newbrand.com/some%20path").To(Equal(redirectURL))
+
+			redirectURL, _ = domain.GetRedirect(newRequest("http://de.brand.com/product/42/shoes/red"))
+			Expect("https://shop.example.com/shoes?sku=42&ref=de.brand.com").To(Equal(redirectURL))
+
+			redirectURL, _ = domain.GetRedirect(newRequest("http://de.brand.com/legacy/page?id=5"))
+			Expect("https://de.newbrand.com/de/archive?q=id=5").To(Equal(redirectURL))
+
+			redirectURL, _ = domain.GetRedirect(newRequest("http://de.brand.com/plain/page?id=5"))
+			Expect("https://de.newbrand.com/plain/page?id=5").To(Equal(redirectURL))
+		})
+
+		It("Domain struct validating templates", func() {
+			domain := &db.Domain{
+				ID:           "1",
+				Name:         "example.com",
+				Created:      "now",
+				Modified:     "now",
+				Redirect:     "https://{unknown}.example.com",
+				RedirectCode: 301,
+				PathMapping: &db.PathList{
+					db.PathMappingEntry{From: "/a", To: "/{1}"},
+					db.PathMappingEntry{From: "^/b/(.*)", Regex: true, To: "/{2}"},
+					db.PathMappingEntry{From: "^/c/(?P<slug>.*)", Regex: true, To: "/{slug}/{1}/{label2}"},
+				},
+			}
+			Expect(domain.Validate().Messages()).To(Equal([]string{
+				"Invalid domain redirect template",
+				"Invalid redirect template on path /a",
+				"Invalid redirect template on path ^/b/(.*)",
+			}))
+		})
+
+		It("Domain struct redirect with weighted split targets", func() {
+			domain := &db.Domain{
+				Name:         "campaign.example.com",
+				Redirect:     "https://www.example.com",
+				RedirectCode: 302,
+				Targets: []db.WeightedTarget{
+					{Name: "a", URL: "https://a.example.com/", Weight: 0},
+					{Name: "b", URL: "https://b.example.com/", Weight: 100},
+				},
+				PathMapping: &db.PathList{
+					db.PathMappingEntry{From: "/landing", Targets: []db.WeightedTarget{
+						{Name: "old", URL: "/landing-old", Weight: 1},
+						{Name: "new", URL: "/landing-new", Weight: 1},
+					}},
+					db.PathMappingEntry{From: "/moved", To: "https://moved.example.com/"},
+					db.PathMappingEntry{From: "/relative", To: "/relative-new"},
+				},
+			}
+
+			url, err := url.Parse("https://campaign.example.com/")
+			Expect(err).To(BeNil())
+			decision := domain.Resolve(&http.Request{URL: url})
+			Expect(decision.Location).To(Equal("https://b.example.com/"))
+			Expect(decision.Code).To(Equal(302))
+			Expect(decision.Variant).To(Equal("b"))
+			Expect(decision.Split).To(Equal(""))
+			Expect(decision.Cookie).NotTo(BeNil())
+
+			// the variant cookie keeps the visitor on the assigned variant
+			url, err = url.Parse("https://campaign.example.com/landing")
+			Expect(err).To(BeNil())
+			decision = domain.Resolve(&http.Request{URL: url})
+			Expect(decision.Split).To(Equal("/landing"))
+			cookie := decision.Cookie
+			for i := 0; i < 10; i++ {
+				sticky := domain.Resolve(&http.Request{URL: url, Header: http.Header{"Cookie": {cookie.String()}}})
+				Expect(sticky.Variant).To(Equal(decision.Variant))
+				Expect(sticky.Location).To(Equal("https://www.example.com/landing-" + decision.Variant))
+			}
+
+			// the domain split only applies to rules based on the default redirect
+			url, err = url.Parse("https://campaign.example.com/moved")
+			Expect(err).To(BeNil())
+			decision = domain.Resolve(&http.Request{URL: url})
+			Expect(decision.Location).To(Equal("https://moved.example.com/"))
+			Expect(decision.Variant).To(Equal(""))
+			Expect(decision.Cookie).To(BeNil())
+
+			url, err = url.Parse("https://campaign.example.com/relative")
+			Expect(err).To(BeNil())
+			decision = domain.Resolve(&http.Request{URL: url})
+			Expect(decision.Location).To(Equal("https://b.example.com/relative-new"))
+			Expect(decision.Variant).To(Equal("b"))
+			Expect(decision.Cookie).NotTo(BeNil())
+
+			domain.ID = "1"
+			domain.Created = "now"
+			domain.Modified = "now"
+			Expect(domain.Validate()).To(BeEmpty())
+
+			domain.RedirectCode = 301
+			domain.Targets[1].Weight = 0
+			Expect(domain.Validate().Messages()).To(Equal([]string{
+				"Invalid domain split targets",
+				"Invalid redirect http status code for a split",
+				"Invalid redirect http status code for the split on path /landing",
+			}))
+		})
+
+		It("Domain struct redirect with validity windows", func() {
+			past := time.Now().Add(-time.Hour).Format(time.RFC3339)
+			future := time.Now().Add(time.Hour).Format(time.RFC3339)
+
+			domain := &db.Domain{
+				Name:         "example.com",
+				Redirect:     "https://www.example.com",
+				RedirectCode: 302,
+				PathMapping: &db.PathList{
+					db.PathMappingEntry{From: "/sale", To: "/expired-sale", ValidUntil: past},
+					db.PathMappingEntry{From: "/sale", To: "/upcoming-sale", ValidFrom: future},
+					db.PathMappingEntry{From: "/sale", To: "/current-sale", ValidFrom: past, ValidUntil: future},
+				},
+			}
+
+			url, err := url.Parse("https://example.com/sale")
+			Expect(err).To(BeNil())
+			redirectURL, _ := domain.GetRedirect(&http.Request{URL: url})
+			Expect("https://www.example.com/current-sale").To(Equal(redirectURL))
+
+			cleaned, removed := domain.WithoutExpiredPaths(time.Now())
+			Expect(removed).To(Equal(1))
+			Expect(*cleaned.PathMapping).To(HaveLen(2))
+			Expect(*domain.PathMapping).To(HaveLen(3))
+
+			domain.ValidUntil = past
+			Expect(domain.IsExpired(time.Now())).To(BeTrue())
+			decision := domain.Resolve(&http.Request{URL: url})
+			Expect(decision.Location).To(Equal(""))
+			Expect(decision.Code).To(Equal(http.StatusGone))
+
+			db.InactiveRedirect = "https://www.example.com/campaign-over"
+			defer func() { db.InactiveRedirect = "" }()
+			domain.ValidUntil = ""
+			domain.ValidFrom = future
+			Expect(domain.IsExpired(time.Now())).To(BeFalse())
+			decision = domain.Resolve(&http.Request{URL: url})
+			Expect(decision.Location).To(Equal("https://www.example.com/campaign-over"))
+			Expect(decision.Code).To(Equal(http.StatusFound))
+
+			domain.ID = "1"
+			domain.Created = "now"
+			domain.Modified = "now"
+			domain.ValidUntil = past
+			Expect(domain.Validate().Messages()).To(Equal([]string{"Invalid domain validity window"}))
+		})
+
+		It("Domain struct redirect chain and loop detection", func() {
+			managed := map[string]*db.Domain{
+				"a.example.com": {Name: "a.example.com", Redirect: "https://b.example.com/", RedirectCode: 301},
+				"b.example.com": {Name: "b.example.com", Redirect: "https://c.example.com/", RedirectCode: 301},
+				"c.example.com": {Name: "c.example.com", Redirect: "https://www.example.org/", RedirectCode: 301},
+			}
+			lookup := func(host string) (*db.Domain, bool) {
+				domain, found := managed[host]
+				return domain, found
+			}
+
+			report := managed["c.example.com"].CheckChains(lookup)
+			Expect(report.Loops).To(BeEmpty())
+			Expect(report.Chains).To(BeEmpty())
+
+			report = managed["a.example.com"].CheckChains(lookup)
+			Expect(report.Loops).To(BeEmpty())
+			Expect(report.Chains).To(HaveLen(1))
+			Expect(report.Chains[0].Hops).To(Equal([]string{"https://b.example.com/", "https://c.example.com/", "https://www.example.org/"}))
+			Expect(report.Chains[0].Flatten).To(Equal("https://www.example.org/"))
+
+			managed["c.example.com"].Redirect = "https://a.example.com"
+			report = managed["a.example.com"].CheckChains(lookup)
+			Expect(report.Loops).To(HaveLen(1))
+
+			managed["c.example.com"].Redirect = "https://www.example.org/"
+			managed["c.example.com"].PathMapping = &db.PathList{
+				db.PathMappingEntry{From: "/self", To: "https://c.example.com/self/"},
+			}
+			report = managed["c.example.com"].CheckChains(lookup)
+			Expect(report.Loops).To(HaveLen(1))
+			Expect(report.Loops[0].Start).To(Equal("https://c.example.com/self"))
+		})
+
+		It("Domain struct redirect chain through splits and https urls", func() {
+			managed := map[string]*db.Domain{
+				"s.example.com": {Name: "s.example.com", Redirect: "https://www.example.org/", RedirectCode: 302, Targets: []db.WeightedTarget{
+					{URL: "https://www.example.org/", Weight: 99},
+					{URL: "https://t.example.com/", Weight: 1},
+				}},
+				"t.example.com": {Name: "t.example.com", Redirect: "{scheme}://u.example.com/", RedirectCode: 301},
+				"u.example.com": {Name: "u.example.com", Redirect: "https://s.example.com/", RedirectCode: 301},
+			}
+			lookup := func(host string) (*db.Domain, bool) {
+				domain, found := managed[host]
+				return domain, found
+			}
+
+			// the rarely picked variant is followed on every check
+			for i := 0; i < 10; i++ {
+				report := managed["s.example.com"].CheckChains(lookup)
+				Expect(report.Loops).To(HaveLen(1))
+				Expect(report.Loops[0].Hops).To(Equal([]string{"https://t.example.com/", "https://u.example.com/", "https://s.example.com/"}))
+			}
+
+			managed["u.example.com"].Redirect = "https://www.example.org/"
+			report := managed["t.example.com"].CheckChains(lookup)
+			Expect(report.Loops).To(BeEmpty())
+			Expect(report.Chains).To(HaveLen(1))
+			Expect(report.Chains[0].Hops).To(Equal([]string{"https://u.example.com/", "https://www.example.org/"}))
+		})
+
+		It("Domain struct with non redirect actions", func() {
+			domain := &db.Domain{
+				ID:       "1",
+				Name:     "retired.example.com",
+				Created:  "now",
+				Modified: "now",
+				Response: db.Response{Action: db.ActionStatus, Status: http.StatusGone},
+				PathMapping: &db.PathList{
+					db.PathMappingEntry{From: "/notice", Response: db.Response{Action: db.ActionStatic, Body: "<h1>Gone</h1>"}},
+					db.PathMappingEntry{From: "/moved", To: "https://www.example.com/moved", Code: 301},
+				},
+			}
+			Expect(domain.Validate()).To(BeEmpty())
+
+			url, err := url.Parse("https://retired.example.com/anything")
+			Expect(err).To(BeNil())
+			decision := domain.Resolve(&http.Request{URL: url})
+			Expect(decision.Action).To(Equal(db.ActionStatus))
+			Expect(decision.Code).To(Equal(http.StatusGone))
+
+			url, err = url.Parse("https://retired.example.com/notice")
+			Expect(err).To(BeNil())
+			decision = domain.Resolve(&http.Request{URL: url})
+			Expect(decision.Action).To(Equal(db.ActionStatic))
+			Expect(decision.Code).To(Equal(http.StatusOK))
+			Expect(decision.Body).To(Equal("<h1>Gone</h1>"))
+			Expect(decision.ContentType).To(Equal("text/html; charset=utf-8"))
+
+			url, err = url.Parse("https://retired.example.com/moved")
+			Expect(err).To(BeNil())
+			decision = domain.Resolve(&http.Request{URL: url})
+			Expect(decision.Action).To(Equal(""))
+			Expect(decision.Location).To(Equal("https://www.example.com/moved"))
+			Expect(decision.Code).To(Equal(301))
+
+			domain.Status = 301
+			domain.Action = "teapot"
+			Expect(domain.Validate().Messages()).To(Equal([]string{"Invalid domain action"}))
+			domain.Action = db.ActionStatus
+			Expect(domain.Validate().Messages()).To(Equal([]string{"Invalid domain response status code"}))
+		})
+
+		It("Domain struct with proxied paths", func() {
+			domain := &db.Domain{
+				ID:           "1",
+				Name:         "migrate.example.com",
+				Redirect:     "https://www.example.com",
+				RedirectCode: 301,
+				Created:      "now",
+				Modified:     "now",
+				PathMapping: &db.PathList{
+					db.PathMappingEntry{From: "/api/", Response: db.Response{Action: db.ActionProxy, Proxy: &db.Proxy{Upstream: "https://backend.internal/v1", StripPrefix: true, Timeout: 5}}},
+					db.PathMappingEntry{From: "/legacy", Response: db.Response{Action: db.ActionProxy, Proxy: &db.Proxy{Upstream: "http://legacy.internal/?source=swerve", PreserveHost: true}}},
+				},
+			}
+			Expect(domain.Validate()).To(BeEmpty())
+
+			url, err := url.Parse("https://migrate.example.com/api/users/42?expand=1")
+			Expect(err).To(BeNil())
+			decision := domain.Resolve(&http.Request{URL: url})
+			Expect(decision.Action).To(Equal(db.ActionProxy))
+			Expect(decision.Location).To(Equal("https://backend.internal/v1/users/42?expand=1"))
+			Expect(decision.Proxy.Timeout).To(Equal(5))
+
+			url, err = url.Parse("https://migrate.example.com/legacy/page.html?id=1")
+			Expect(err).To(BeNil())
+			decision = domain.Resolve(&http.Request{URL: url})
+			Expect(decision.Action).To(Equal(db.ActionProxy))
+			Expect(decision.Location).To(Equal("http://legacy.internal/legacy/page.html?source=swerve&id=1"))
+
+			url, err = url.Parse("https://migrate.example.com/other")
+			Expect(err).To(BeNil())
+			location, code := domain.GetRedirect(&http.Request{URL: url})
+			Expect(location).To(Equal("https://www.example.com"))
+			Expect(code).To(Equal(301))
+
+			(*domain.PathMapping)[0].Proxy = &db.Proxy{Upstream: "/relative"}
+			(*domain.PathMapping)[1].Proxy = nil
+			Expect(domain.Validate().Messages()).To(Equal([]string{"Invalid proxy on path /api/", "Invalid proxy on path /legacy"}))
+		})
+
+		It("Domain struct with not found response", func() {
+			domain := &db.Domain{
+				ID:           "1",
+				Name:         "shop.example.com",
+				Redirect:     "https://www.example.com/shop",
+				RedirectCode: 301,
+				Created:      "now",
+				Modified:     "now",
+				NotFound:     &db.Response{Action: db.ActionStatic, Body: "<h1>Not found</h1>"},
+				PathMapping: &db.PathList{
+					db.PathMappingEntry{From: "/cart", To: "/basket"},
+				},
+			}
+			Expect(domain.Validate()).To(BeEmpty())
+
+			url, err := url.Parse("https://shop.example.com/unknown")
+			Expect(err).To(BeNil())
+			decision := domain.Resolve(&http.Request{URL: url})
+			Expect(decision.Action).To(Equal(db.ActionStatic))
+			Expect(decision.Code).To(Equal(http.StatusNotFound))
+			Expect(decision.Body).To(Equal("<h1>Not found</h1>"))
+
+			for _, path := range []string{"/", "/cart"} {
+				url, err = url.Parse("https://shop.example.com" + path)
+				Expect(err).To(BeNil())
+				decision = domain.Resolve(&http.Request{URL: url})
+				Expect(decision.Action).To(Equal(""))
+				Expect(decision.Code).To(Equal(301))
+			}
+
+			domain.Promotable = true
+			url, err = url.Parse("https://shop.example.com/unknown")
+			Expect(err).To(BeNil())
+			location, code := domain.GetRedirect(&http.Request{URL: url})
+			Expect(location).To(Equal("https://www.example.com/shop/unknown"))
+			Expect(code).To(Equal(301))
+
+			domain.NotFound = &db.Response{Action: db.ActionProxy}
+			Expect(domain.Validate().Messages()).To(Equal([]string{"Invalid domain not found response"}))
+		})
+
+		It("Domain struct with normalized names", func() {
+			for host, canonical := range map[string]string{
+				"EXAMPLE.com":      "example.com",
+				"example.com:8080": "example.com",
+				"example.com.":     "example.com",
+				"Bücher.de":        "xn--bcher-kva.de",
+				"xn--bcher-kva.de": "xn--bcher-kva.de",
+				"*.Bücher.de":      "*.xn--bcher-kva.de",
+				"127.0.0.1:8080":   "127.0.0.1",
+				"[::1]:8080":       "::1",
+			} {
+				name, err := db.NormalizeHost(host)
+				Expect(err).To(BeNil())
+				Expect(name).To(Equal(canonical))
+			}
+
+			_, err := db.NormalizeHost("")
+			Expect(err).NotTo(BeNil())
+			_, err = db.NormalizeHost("exa mple.com")
+			Expect(err).NotTo(BeNil())
+
+			domain := &db.Domain{
+				ID:           "1",
+				Name:         "Bücher.de.",
+				Redirect:     "https://www.example.com",
+				RedirectCode: 301,
+				Created:      "now",
+				Modified:     "now",
+			}
+			Expect(domain.Validate()).To(BeEmpty())
+			Expect(domain.Name).To(Equal("xn--bcher-kva.de"))
+			Expect(domain.DisplayName).To(Equal("bücher.de"))
+
+			url, err := url.Parse("https://xn--bcher-kva.de/")
+			Expect(err).To(BeNil())
+			domain.Redirect = "https://shop.example.com/?ref={host}"
+			location, _ := domain.GetRedirect(&http.Request{URL: url, Host: "XN--BCHER-KVA.DE:443"})
+			Expect(location).To(Equal("https://shop.example.com/?ref=xn--bcher-kva.de"))
+		})
+
+		It("Domain struct with aliases", func() {
+			domain := &db.Domain{
+				ID:           "1",
+				Name:         "example.com",
+				Aliases:      []string{"WWW.example.com", "exmaple.com.", "examp1e.com"},
+				Redirect:     "https://www.example.org",
+				RedirectCode: 301,
+				Created:      "now",
+				Modified:     "now",
+			}
+			Expect(domain.Validate()).To(BeEmpty())
+			Expect(domain.Aliases).To(Equal([]string{"www.example.com", "exmaple.com", "examp1e.com"}))
+			Expect(domain.Names()).To(Equal([]string{"example.com", "www.example.com", "exmaple.com", "examp1e.com"}))
+
+			others := []db.Domain{
+				{Name: "example.com", Aliases: []string{"www.example.com"}},
+				{Name: "other.com", Aliases: []string{"EXMAPLE.com"}},
+				{Name: "examp1e.com"},
+			}
+			Expect(domain.Conflicts(others)).To(Equal([]string{"exmaple.com", "examp1e.com"}))
+			Expect(domain.Conflicts(others[:1])).To(BeEmpty())
+
+			domain.Aliases = []string{"*.example.com", "example.com", "www.example.com", "www.example.com"}
+			Expect(domain.Validate().Messages()).To(Equal([]string{
+				"Invalid alias *.example.com",
+				"Duplicate alias example.com",
+				"Duplicate alias www.example.com",
+			}))
+		})
+
+		It("Domain struct with hsts settings", func() {
+			domain := &db.Domain{
+				ID:           "1",
+				Name:         "example.com",
+				Redirect:     "https://www.example.org",
+				RedirectCode: 301,
+				Created:      "now",
+				Modified:     "now",
+				ForceHTTPS:   true,
+				HSTS:         &db.HSTS{MaxAge: 300},
+			}
+			Expect(domain.Validate()).To(BeEmpty())
+			Expect(domain.HSTS.Header()).To(Equal("max-age=300"))
+
+			domain.HSTS = &db.HSTS{MaxAge: 63072000, IncludeSubDomains: true, Preload: true}
+			Expect(domain.Validate()).To(BeEmpty())
+			Expect(domain.HSTS.Header()).To(Equal("max-age=63072000; includeSubDomains; preload"))
+
+			domain.HSTS.IncludeSubDomains = false
+			Expect(domain.Validate().Messages()).To(Equal([]string{"Invalid hsts settings"}))
+
+			domain.HSTS = &db.HSTS{MaxAge: 300, IncludeSubDomains: true, Preload: true}
+			Expect(domain.Validate().Messages()).To(Equal([]string{"Invalid hsts settings"}))
+		})
+
+		It("Domain struct with compiled path index", func() {
+			domain := &db.Domain{
+				ID:           "1",
+				Name:         "example.com",
+				Redirect:     "https://www.example.org",
+				RedirectCode: 301,
+				Created:      "now",
+				Modified:     "now",
+				PathMapping: &db.PathList{
+					db.PathMappingEntry{From: "/index.php?page=1", To: "/first"},
+					db.PathMappingEntry{From: "^/p/([0-9]+)$", Regex: true, To: "https://shop.example.com/{1}"},
+					db.PathMappingEntry{From: "/shop/items", To: "/items"},
+					db.PathMappingEntry{From: "/shop/cart", To: "/basket"},
+					db.PathMappingEntry{From: "/shop/item", To: "/old-item", Exact: true},
+					db.PathMappingEntry{From: "/empty"},
+					db.PathMappingEntry{From: "/shop", To: "/store"},
+					db.PathMappingEntry{From: "/news", To: "/mobile-news", Device: db.DeviceMobile},
+					db.PathMappingEntry{From: "/", To: "/root"},
+				},
+			}
+			Expect(domain.Validate()).To(BeEmpty())
+			compiled := *domain
+			compiled.Compile()
+
+			for _, target := range []string{
+				"/", "/shop", "/shop/", "/shop/cart/add", "/shop/item", "/shop/item/1", "/shop/items/1",
+				"/index.php?page=1", "/index.php?page=2", "/news", "/p/42", "/p/42/x", "/empty", "/other?x=1",
+			} {
+				url, err := url.Parse("https://example.com" + target)
+				Expect(err).To(BeNil())
+				expected := domain.Resolve(&http.Request{URL: url, Header: http.Header{}})
+				Expect(compiled.Resolve(&http.Request{URL: url, Header: http.Header{}})).To(Equal(expected), target)
+			}
+
+			url, err := url.Parse("https://example.com/shop/item")
+			Expect(err).To(BeNil())
+			location, _ := compiled.GetRedirect(&http.Request{URL: url})
+			Expect(location).To(Equal("https://www.example.org/old-item"))
+
+			url, err = url.Parse("https://example.com/shop/item/1")
+			Expect(err).To(BeNil())
+			location, _ = compiled.GetRedirect(&http.Request{URL: url})
+			Expect(location).To(Equal("https://www.example.org/store"))
+
+			(*domain.PathMapping)[1].Exact = true
+			Expect(domain.Validate().Messages()).To(Equal([]string{"Invalid condition on path ^/p/([0-9]+)$"}))
+		})
+
+		It("Domain struct explaining the matched rule", func() {
+			domain := db.Domain{
+				ID:           "1",
+				Name:         "example.com",
+				Redirect:     "https://www.example.org",
+				RedirectCode: 301,
+				Created:      "now",
+				Modified:     "now",
+				PathMapping: &db.PathList{
+					db.PathMappingEntry{From: "/a", To: "/short"},
+					db.PathMappingEntry{From: "/a/longer", To: "/long", Exact: true},
+					db.PathMappingEntry{From: "^/p/([0-9]+)$", Regex: true, To: "/product/{1}"},
+					db.PathMappingEntry{From: "/m", To: "/mobile", Device: db.DeviceMobile},
+				},
+			}
+			sorted := domain.Sorted()
+
+			for target, rule := range map[string][]interface{}{
+				"/a/longer": {1, db.RuleExact},
+				"/a/other":  {0, db.RulePrefix},
+				"/p/42":     {2, db.RuleRegex},
+			} {
+				url, err := url.Parse("https://example.com" + target)
+				Expect(err).To(BeNil())
+				decision := sorted.Resolve(&http.Request{URL: url, Header: http.Header{}})
+				Expect(decision.Rule).NotTo(BeNil())
+				Expect(sorted.RuleIndex(decision.Rule)).To(Equal(rule[0]))
+				Expect(decision.Rule.Type()).To(Equal(rule[1]))
+			}
+
+			url, err := url.Parse("https://example.com/m")
+			Expect(err).To(BeNil())
+			decision := domain.Resolve(&http.Request{URL: url, Header: http.Header{"User-Agent": {"Mozilla/5.0 (iPhone; CPU iPhone OS 12_0 like Mac OS X) Mobile"}}})
+			Expect(domain.RuleIndex(decision.Rule)).To(Equal(3))
+			Expect(decision.Rule.Type()).To(Equal(db.RuleConditional))
+
+			url, err = url.Parse("https://example.com/other")
+			Expect(err).To(BeNil())
+			decision = domain.Resolve(&http.Request{URL: url, Header: http.Header{}})
+			Expect(decision.Rule).To(BeNil())
+			Expect(domain.RuleIndex(decision.Rule)).To(Equal(-1))
+		})
+
+		It("Domain struct bulk redirect verification", func() {
+			managed := map[string]*db.Domain{
+				"old.example.com": {
+					Name:         "old.example.com",
+					Redirect:     "https://www.example.com/",
+					RedirectCode: 301,
+					PathMapping: &db.PathList{
+						db.PathMappingEntry{From: "/shop", To: "https://shop.example.com/", Code: 302},
+						db.PathMappingEntry{From: "/secure", To: "{scheme}://secure.example.com/"},
+					},
+				},
+			}
+			lookup := func(host string) (*db.Domain, bool) {
+				domain, found := managed[host]
+				return domain, found
+			}
+
+			cases, err := db.ReadVerifyCSV(strings.NewReader("url,expected,code\n" +
+				"https://old.example.com/,https://www.example.com,301\n" +
+				"https://old.example.com/shop,https://shop.example.com/\n" +
+				"https://old.example.com/shop,https://shop.example.com/,301\n" +
+				"https://unknown.example.com/,https://www.example.com/\n" +
+				"https://old.example.com/secure,https://secure.example.com/\n"))
+			Expect(err).To(BeNil())
+			Expect(cases).To(HaveLen(5))
+			Expect(cases[0]).To(Equal(db.VerifyCase{URL: "https://old.example.com/", Expected: "https://www.example.com", ExpectedCode: 301}))
+
+			report := db.Verify(cases, lookup)
+			Expect(report.Total).To(Equal(5))
+			Expect(report.Passed).To(Equal(3))
+			Expect(report.Failed).To(Equal(2))
+			Expect(report.Failures[0].Code).To(Equal(http.StatusFound))
+			Expect(report.Failures[0].Pass).To(BeFalse())
+			Expect(report.Failures[1].Error).To(Equal("Unknown host"))
+
+			_, err = db.ReadVerifyCSV(strings.NewReader("https://old.example.com/\n"))
+			Expect(err).To(Equal(errors.New("Invalid line 1")))
+		})
+
+		It("Domain struct strict validation", func() {
+			domain := &db.Domain{
+				ID:           "1",
+				Name:         "co.uk",
+				Aliases:      []string{"github.io"},
+				Created:      "now",
+				Modified:     "now",
+				Redirect:     "/relative",
+				RedirectCode: 304,
+				PathMapping: &db.PathList{
+					db.PathMappingEntry{From: "", To: "/a"},
+					db.PathMappingEntry{From: "old", To: "/b"},
+					db.PathMappingEntry{From: "/c", To: "https://exa mple.com/"},
+					db.PathMappingEntry{From: "/d", To: "/d-new", Code: 305},
+					db.PathMappingEntry{From: "/d", To: "/d-other"},
+					db.PathMappingEntry{From: "/d", To: "/d-de", Languages: []string{"de"}},
+				},
+			}
+
+			errList := domain.Validate()
+			Expect(errList.Messages()).To(Equal([]string{
+				"Invalid domain name co.uk is a public suffix",
+				"Invalid alias github.io is a public suffix",
+				"Invalid domain redirect target",
+				"Invalid redirect http status code",
+				"Empty from on path 0",
+				"Invalid from on path old",
+				"Invalid redirect target on path /c",
+				"Invalid redirect http status code on path /d",
+				"Duplicate path /d",
+			}))
+			Expect(errList[0]).To(Equal(db.ValidationError{Field: "domain", Code: db.ValidationPublicSuffix, Message: "Invalid domain name co.uk is a public suffix"}))
+			Expect(errList[4].Field).To(Equal("paths[0].from"))
+			Expect(errList[4].Code).To(Equal(db.ValidationRequired))
+			Expect(errList[8].Field).To(Equal("paths[4].from"))
+			Expect(errList[8].Code).To(Equal(db.ValidationDuplicate))
+
+			domain.Name = "localhost"
+			domain.Aliases = nil
+			domain.Redirect = "{scheme}://www.example.com{path}"
+			domain.RedirectCode = 308
+			domain.PathMapping = &db.PathList{
+				db.PathMappingEntry{From: "/d", To: "{path}"},
+				db.PathMappingEntry{From: "/d", To: "/d-de", Languages: []string{"de"}},
+			}
+			Expect(domain.Validate()).To(BeEmpty())
+
+			for _, name := range []string{"ex_ample.com", "-bad-.com", "a..b.com", ".example.com"} {
+				domain.Name = name
+				Expect(domain.Validate()).To(Equal(db.ValidationErrors{
+					{Field: "domain", Code: db.ValidationInvalid, Message: "Invalid domain name"},
+				}), name)
+			}
+		})
+
+		It("Domain struct with path normalization", func() {
+			domain := &db.Domain{
+				ID:           "1",
+				Name:         "example.com",
+				Created:      "now",
+				Modified:     "now",
+				Redirect:     "https://www.example.com/",
+				RedirectCode: 301,
+				PathMapping: &db.PathList{
+					db.PathMappingEntry{From: "/Shop/", To: "https://shop.example.com/", Exact: true},
+					db.PathMappingEntry{From: "/über uns", To: "https://www.example.com/about", Exact: true},
+					db.PathMappingEntry{From: "/Docs", To: "https://docs.example.com/"},
+					db.PathMappingEntry{From: "/Blog/", To: "https://blog.example.com/"},
+					db.PathMappingEntry{From: "^/item/([0-9]+)$", To: "https://shop.example.com/p/{1}", Regex: true},
+				},
+				PathNormalization: &db.PathNormalization{
+					CaseInsensitive:    true,
+					StripTrailingSlash: true,
+					Decode:             true,
+					CollapseSlashes:    true,
+				},
+			}
+			Expect(domain.Validate()).To(BeEmpty())
+			Expect((*domain.PathMapping)[0].From).To(Equal("/shop"))
+			Expect((*domain.PathMapping)[1].From).To(Equal("/%c3%bcber%20uns"))
+			Expect((*domain.PathMapping)[2].From).To(Equal("/docs"))
+			Expect((*domain.PathMapping)[3].From).To(Equal("/blog/"))
+			domain.Compile()
+
+			for path, expected := range map[string]string{
+				"/shop":                  "https://shop.example.com/",
+				"/SHOP//":                "https://shop.example.com/",
+				"/%C3%BCber%20uns/":      "https://www.example.com/about",
+				"/%c3%bcber uns":         "https://www.example.com/about",
+				"//docs//Guide":          "https://docs.example.com/Guide",
+				"/Item/42":               "https://shop.example.com/p/42",
+				"/shopping":              "https://www.example.com/",
+				"/%7Edocs":               "https://www.example.com/",
+				"/docs/%7Euser/settings": "https://docs.example.com/~user/settings",
+				"/blog":                  "https://blog.example.com/",
+				"/Blog//":                "https://blog.example.com/",
+				"/blog/roll":             "https://blog.example.com/roll",
+				"/blogroll":              "https://www.example.com/",
+			} {
+				url, err := url.Parse("https://example.com" + path)
+				Expect(err).To(BeNil())
+				location, _ := domain.GetRedirect(&http.Request{URL: url, Header: http.Header{}})
+				Expect(location).To(Equal(expected), path)
+			}
+
+			domain.PathNormalization = nil
+			domain.PathMapping = &db.PathList{
+				db.PathMappingEntry{From: "/docs", To: "https://docs.example.com/", Exact: true},
+				db.PathMappingEntry{From: "/Docs", To: "https://docs.example.com/", Exact: true},
+			}
+			Expect(domain.Validate()).To(BeEmpty())
+			domain.PathNormalization = &db.PathNormalization{CaseInsensitive: true}
+			Expect(domain.Validate().Messages()).To(Equal([]string{"Duplicate path /docs"}))
+		})
+
+		It("Domain struct with response headers", func() {
+			maxAge := 3600
+			domain := &db.Domain{
+				ID:           "1",
+				Name:         "example.com",
+				Created:      "now",
+				Modified:     "now",
+				Redirect:     "https://www.example.com/",
+				RedirectCode: 301,
+				ResponseHeaders: &db.ResponseHeaders{
+					MaxAge:    &maxAge,
+					RobotsTag: "noindex",
+					Headers:   map[string]string{"X-Team": "web"},
+				},
+				PathMapping: &db.PathList{
+					db.PathMappingEntry{From: "/campaign", To: "https://www.example.com/offer", ResponseHeaders: &db.ResponseHeaders{
+						CacheControl: "no-store",
+						Canonical:    "https://www.example.com/offer",
+					}},
+				},
+			}
+			Expect(domain.Validate()).To(BeEmpty())
+
+			url, err := url.Parse("https://example.com/")
+			Expect(err).To(BeNil())
+			decision := domain.Resolve(&http.Request{URL: url})
+			Expect(decision.Headers).To(Equal(http.Header{
+				"Cache-Control": {"max-age=3600"},
+				"X-Robots-Tag":  {"noindex"},
+				"X-Team":        {"web"},
+			}))
+
+			url, err = url.Parse("https://example.com/campaign")
+			Expect(err).To(BeNil())
+			decision = domain.Resolve(&http.Request{URL: url})
+			Expect(decision.Headers).To(Equal(http.Header{
+				"Cache-Control": {"no-store"},
+				"X-Robots-Tag":  {"noindex"},
+				"X-Team":        {"web"},
+				"Link":          {"<https://www.example.com/offer>; rel=\"canonical\""},
+			}))
+
+			domain.ResponseHeaders = nil
+			(*domain.PathMapping)[0].ResponseHeaders = nil
+			decision = domain.Resolve(&http.Request{URL: url})
+			Expect(decision.Headers).To(BeNil())
+
+			domain.ResponseHeaders = &db.ResponseHeaders{Headers: map[string]string{"Location": "https://evil.example.com/"}}
+			(*domain.PathMapping)[0].ResponseHeaders = &db.ResponseHeaders{Canonical: "/offer"}
+			Expect(domain.Validate().Messages()).To(Equal([]string{
+				"Invalid response headers",
+				"Invalid response headers on path /campaign",
+			}))
+		})
 	})
 })
@@ -0,0 +1,103 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	headerNamePattern = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+.^_`|~-]+$")
+	// headers written by the handlers themselves
+	reservedHeaders = map[string]bool{
+		"Location":          true,
+		"Content-Type":      true,
+		"Content-Length":    true,
+		"Transfer-Encoding": true,
+		"Connection":        true,
+		"Set-Cookie":        true,
+	}
+)
+
+// valid checks the header names and values. The canonical url has to be absolute
+func (h *ResponseHeaders) valid() bool {
+	for name, value := range h.Headers {
+		if !headerNamePattern.MatchString(name) || reservedHeaders[http.CanonicalHeaderKey(name)] ||
+			strings.ContainsAny(value, "\r\n") {
+			return false
+		}
+	}
+
+	if h.MaxAge != nil && *h.MaxAge < 0 {
+		return false
+	}
+
+	if strings.ContainsAny(h.CacheControl+h.RobotsTag, "\r\n") {
+		return false
+	}
+
+	if h.Canonical != "" {
+		u, err := url.Parse(h.Canonical)
+		if err != nil || !isAbsoluteURL(h.Canonical) || u.Host == "" || strings.ContainsAny(h.Canonical, "<> \r\n") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// apply sets the headers. The dedicated settings win over the arbitrary headers
+func (h *ResponseHeaders) apply(header http.Header) {
+	if h == nil {
+		return
+	}
+
+	for name, value := range h.Headers {
+		header.Set(name, value)
+	}
+
+	if h.CacheControl != "" {
+		header.Set("Cache-Control", h.CacheControl)
+	} else if h.MaxAge != nil {
+		header.Set("Cache-Control", fmt.Sprintf("max-age=%d", *h.MaxAge))
+	}
+
+	if h.RobotsTag != "" {
+		header.Set("X-Robots-Tag", h.RobotsTag)
+	}
+
+	if h.Canonical != "" {
+		header.Set("Link", fmt.Sprintf("<%s>; rel=\"canonical\"", h.Canonical))
+	}
+}
+
+// ResponseHeader returns the response headers of the domain overridden by the ones of the rule
+func (d *Domain) ResponseHeader(p *PathMappingEntry) http.Header {
+	if d.ResponseHeaders == nil && (p == nil || p.ResponseHeaders == nil) {
+		return nil
+	}
+
+	header := http.Header{}
+	d.ResponseHeaders.apply(header)
+	if p != nil {
+		p.ResponseHeaders.apply(header)
+	}
+
+	return header
+}
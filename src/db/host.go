@@ -0,0 +1,70 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"errors"
+	"net"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+var (
+	errInvalidHost = errors.New("Invalid host")
+)
+
+// NormalizeHost returns the canonical form of a host. The port and the trailing dot are
+// removed and internationalized names are converted to lowercase punycode. Wildcard names
+// keep their prefix
+func NormalizeHost(host string) (string, error) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), nil
+	}
+
+	prefix := ""
+	if strings.HasPrefix(host, WildcardPrefix) {
+		prefix = WildcardPrefix
+		host = host[len(WildcardPrefix):]
+	}
+
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil || ascii == "" {
+		return "", errInvalidHost
+	}
+
+	// the lookup profile accepts empty and overlong labels
+	for _, label := range strings.Split(ascii, ".") {
+		if label == "" || len(label) > 63 {
+			return "", errInvalidHost
+		}
+	}
+
+	return prefix + ascii, nil
+}
+
+// DisplayHost returns the unicode form of a canonical host
+func DisplayHost(host string) string {
+	display, err := idna.Display.ToUnicode(host)
+	if err != nil {
+		return host
+	}
+	return display
+}
@@ -0,0 +1,52 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"strconv"
+)
+
+const (
+	// hstsPreloadMaxAge is the minimal max-age accepted by the preload lists
+	hstsPreloadMaxAge = 31536000
+)
+
+// valid checks the settings. Preloading requires a max-age of at least one year and includeSubDomains
+func (h *HSTS) valid() bool {
+	if h.MaxAge < 0 {
+		return false
+	}
+
+	if h.Preload {
+		return h.MaxAge >= hstsPreloadMaxAge && h.IncludeSubDomains
+	}
+
+	return true
+}
+
+// Header returns the Strict-Transport-Security header value
+func (h *HSTS) Header() string {
+	res := "max-age=" + strconv.Itoa(h.MaxAge)
+
+	if h.IncludeSubDomains {
+		res += "; includeSubDomains"
+	}
+
+	if h.Preload {
+		res += "; preload"
+	}
+
+	return res
+}
@@ -0,0 +1,159 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"sort"
+	"strings"
+)
+
+// pathIndex is the compiled path mapping of a domain. Prefix rules are stored in a radix
+// tree, exact rules in a hash table, regex rules and the rules offering languages are kept in lists
+type pathIndex struct {
+	paths     *PathList
+	tree      *pathNode
+	exact     map[string][]int
+	regex     []int
+	languages []int
+}
+
+// pathNode is a radix tree node holding the rules whose From ends at the node
+type pathNode struct {
+	prefix   string
+	rules    []int
+	children map[byte]*pathNode
+}
+
+// commonPrefix returns the length of the common prefix of both strings
+func commonPrefix(a string, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// insert adds the rule below the node. The prefix of the node is already consumed
+func (n *pathNode) insert(key string, rule int) {
+	for key != "" {
+		child, ok := n.children[key[0]]
+		if !ok {
+			if n.children == nil {
+				n.children = map[byte]*pathNode{}
+			}
+			n.children[key[0]] = &pathNode{prefix: key, rules: []int{rule}}
+			return
+		}
+
+		common := commonPrefix(child.prefix, key)
+		if common < len(child.prefix) {
+			// split the edge at the common prefix
+			split := &pathNode{
+				prefix:   child.prefix[:common],
+				children: map[byte]*pathNode{child.prefix[common]: child},
+			}
+			child.prefix = child.prefix[common:]
+			n.children[key[0]] = split
+			child = split
+		}
+
+		key = key[common:]
+		n = child
+	}
+
+	n.rules = append(n.rules, rule)
+}
+
+// collect appends the rules of all nodes which are a prefix of the key
+func (n *pathNode) collect(key string, res []int) []int {
+	for {
+		res = append(res, n.rules...)
+		if key == "" {
+			return res
+		}
+
+		child, ok := n.children[key[0]]
+		if !ok || !strings.HasPrefix(key, child.prefix) {
+			return res
+		}
+
+		key = key[len(child.prefix):]
+		n = child
+	}
+}
+
+// Compile builds the path index of the domain. The per request cost of the lookup doesn't
+// depend on the number of prefix and exact rules. Compile again after changing the path mapping
+func (d *Domain) Compile() {
+	if d.PathMapping == nil {
+		d.index = nil
+		return
+	}
+
+	index := &pathIndex{
+		paths: d.PathMapping,
+		tree:  &pathNode{},
+		exact: map[string][]int{},
+	}
+
+	for i := range *d.PathMapping {
+		p := &(*d.PathMapping)[i]
+		if len(p.Languages) > 0 {
+			index.languages = append(index.languages, i)
+		}
+		switch {
+		case p.isEmpty():
+			continue
+		case p.Exact:
+			index.exact[p.From] = append(index.exact[p.From], i)
+		case p.Regex:
+			index.regex = append(index.regex, i)
+		default:
+			index.tree.insert(p.From, i)
+		}
+	}
+
+	d.index = index
+}
+
+// match returns the first path mapping entry matching the request. The candidates are
+// tested in the order of the path mapping
+func (x *pathIndex) match(req *request) *PathMappingEntry {
+	key := req.matchPath + "?" + req.rawQuery
+
+	candidates := append([]int{}, x.regex...)
+	candidates = x.tree.collect(key, candidates)
+	// prefix rules ending in a slash match the path without its stripped trailing slash
+	if req.slash {
+		candidates = x.tree.collect(req.matchPath+"/?"+req.rawQuery, candidates)
+	}
+	candidates = append(candidates, x.exact[req.matchPath]...)
+	if req.rawQuery != "" {
+		candidates = append(candidates, x.exact[key]...)
+	}
+	sort.Ints(candidates)
+
+	for n, i := range candidates {
+		if n > 0 && candidates[n-1] == i {
+			continue
+		}
+		p := &(*x.paths)[i]
+		if p.IsActive(req.time) && p.matches(req) {
+			return p
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/axelspringer/swerve/src/db"
+)
+
+// benchmarkDomain creates a compiled domain with the given number of migration rules
+func benchmarkDomain(rules int) *db.Domain {
+	paths := db.PathList{}
+	for i := 0; i < rules; i++ {
+		paths = append(paths,
+			db.PathMappingEntry{From: fmt.Sprintf("/category/%d/article-%d.html", i%100, i), To: fmt.Sprintf("/article/%d", i), Exact: true},
+			db.PathMappingEntry{From: fmt.Sprintf("/archive/%d/", i), To: fmt.Sprintf("/archive?year=%d", i)},
+		)
+	}
+
+	domain := &db.Domain{
+		Name:         "example.com",
+		Redirect:     "https://www.example.com",
+		RedirectCode: 301,
+		PathMapping:  &paths,
+	}
+	domain.Compile()
+
+	return domain
+}
+
+func benchmarkResolve(b *testing.B, rules int) {
+	domain := benchmarkDomain(rules)
+	requests := []*http.Request{}
+	for _, target := range []string{
+		fmt.Sprintf("/category/%d/article-%d.html", (rules/2)%100, rules/2),
+		fmt.Sprintf("/archive/%d/index.html", rules-1),
+		"/unknown/path",
+	} {
+		u, _ := url.Parse("https://example.com" + target)
+		requests = append(requests, &http.Request{URL: u, Host: "example.com", Header: http.Header{}})
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		domain.Resolve(requests[i%len(requests)])
+	}
+}
+
+func BenchmarkResolve100(b *testing.B) {
+	benchmarkResolve(b, 100)
+}
+
+func BenchmarkResolve10000(b *testing.B) {
+	benchmarkResolve(b, 10000)
+}
+
+func BenchmarkResolve100000(b *testing.B) {
+	benchmarkResolve(b, 100000)
+}
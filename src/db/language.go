@@ -0,0 +1,147 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// acceptedLanguage is a single weighted entry of the Accept-Language header
+type acceptedLanguage struct {
+	tag     string
+	quality float64
+}
+
+// parseAcceptLanguage returns the accepted languages ordered by quality
+func parseAcceptLanguage(header string) []acceptedLanguage {
+	res := []acceptedLanguage{}
+
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" {
+			continue
+		}
+
+		quality := 1.0
+		for _, f := range fields[1:] {
+			f = strings.TrimSpace(f)
+			if strings.HasPrefix(f, "q=") {
+				if q, err := strconv.ParseFloat(f[2:], 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		if quality <= 0 {
+			continue
+		}
+
+		res = append(res, acceptedLanguage{tag: tag, quality: quality})
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].quality > res[j].quality
+	})
+
+	return res
+}
+
+// languageMatches tests an accepted tag against an offered tag. "de" matches "de-AT" in both directions
+func languageMatches(accepted string, offered string) bool {
+	offered = strings.ToLower(offered)
+	return accepted == offered ||
+		strings.HasPrefix(accepted, offered+"-") ||
+		strings.HasPrefix(offered, accepted+"-")
+}
+
+// negotiateLanguage picks the offered language best matching the Accept-Language header
+func negotiateLanguage(header string, offered []string) string {
+	for _, accepted := range parseAcceptLanguage(header) {
+		if accepted.tag == "*" {
+			return ""
+		}
+		// prefer the exact tag before a language range match
+		for _, o := range offered {
+			if accepted.tag == strings.ToLower(o) {
+				return o
+			}
+		}
+		for _, o := range offered {
+			if languageMatches(accepted.tag, o) {
+				return o
+			}
+		}
+	}
+
+	return ""
+}
+
+// matchLanguage tests the negotiated language against the languages of a rule
+func matchLanguage(negotiated string, languages []string) bool {
+	if negotiated == "" {
+		return false
+	}
+
+	for _, l := range languages {
+		if strings.EqualFold(l, negotiated) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// offeredLanguages collects the languages of the active rules matching the path of the request
+func (d *Domain) offeredLanguages(req *request) []string {
+	res := []string{}
+	if d.PathMapping == nil {
+		return res
+	}
+
+	var rules []int
+	if d.index != nil && d.index.paths == d.PathMapping {
+		rules = d.index.languages
+	} else {
+		for i := range *d.PathMapping {
+			if len((*d.PathMapping)[i].Languages) > 0 {
+				rules = append(rules, i)
+			}
+		}
+	}
+
+	for _, i := range rules {
+		p := &(*d.PathMapping)[i]
+		if !p.isEmpty() && p.IsActive(req.time) && p.pathMatches(req) {
+			res = append(res, p.Languages...)
+		}
+	}
+
+	return res
+}
+
+// negotiatedLanguage negotiates the Accept-Language header once against the languages offered
+// for the path of the request
+func (r *request) negotiatedLanguage() string {
+	if !r.offered {
+		r.offered = true
+		if languages := r.domain.offeredLanguages(r); len(languages) > 0 {
+			r.language = negotiateLanguage(r.Header.Get("Accept-Language"), languages)
+		}
+	}
+
+	return r.language
+}
@@ -0,0 +1,127 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"net/url"
+	"strings"
+)
+
+// path normalizes the escaped request or rule path. The case is kept, it is only ignored on matching
+func (n *PathNormalization) path(p string) string {
+	if n == nil {
+		return p
+	}
+
+	// canonical escaping, %7E and ~ or %20 and a space are the same path
+	if n.Decode {
+		if decoded, err := url.PathUnescape(p); err == nil {
+			p = (&url.URL{Path: decoded}).EscapedPath()
+		}
+	}
+
+	if n.CollapseSlashes {
+		for strings.Contains(p, "//") {
+			p = strings.Replace(p, "//", "/", -1)
+		}
+	}
+
+	if n.StripTrailingSlash && len(p) > 1 {
+		p = strings.TrimRight(p, "/")
+		if p == "" {
+			p = "/"
+		}
+	}
+
+	return p
+}
+
+// matchPath returns the form of the normalized path compared against the rules. Escaped
+// paths are ascii, so the lowercase form keeps the length of the path
+func (n *PathNormalization) matchPath(p string) string {
+	if n == nil || !n.CaseInsensitive {
+		return p
+	}
+	return strings.ToLower(p)
+}
+
+// rule normalizes the path part of a rule From. The query string part is kept. Prefix rules
+// keep their trailing slash, so /blog/ doesn't turn into a prefix of /blogroll
+func (n *PathNormalization) rule(from string, prefix bool) string {
+	if n == nil || from == "" {
+		return from
+	}
+
+	query := ""
+	if i := strings.Index(from, "?"); i >= 0 {
+		from, query = from[:i], from[i:]
+	}
+
+	slash := prefix && len(from) > 1 && strings.HasSuffix(from, "/")
+	from = n.matchPath(n.path(from))
+	if slash && !strings.HasSuffix(from, "/") {
+		from += "/"
+	}
+
+	return from + query
+}
+
+// hasPrefix tests the From of a prefix rule against the request path, or the path and the query
+// string. With stripped trailing slashes the path is tested with its trailing slash as well
+func (r *request) hasPrefix(from string, query bool) bool {
+	paths := []string{r.matchPath}
+	if r.slash {
+		paths = append(paths, r.matchPath+"/")
+	}
+
+	for _, p := range paths {
+		if query {
+			p = p + "?" + r.rawQuery
+		}
+		if strings.HasPrefix(p, from) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// restPath returns the request path following the From of a matched prefix rule
+func (r *request) restPath(from string) string {
+	if len(from) >= len(r.path) {
+		return ""
+	}
+	return r.path[len(from):]
+}
+
+// normalizePaths applies the path normalization of the domain to the From of its rules.
+// Regex rules are kept, they are matched case insensitive when configured
+func (d *Domain) normalizePaths() {
+	if d.PathNormalization == nil || d.PathMapping == nil {
+		return
+	}
+
+	for i := range *d.PathMapping {
+		d.NormalizeRule(&(*d.PathMapping)[i])
+	}
+}
+
+// NormalizeRule applies the path normalization of the domain to the From of the rule, e.g. to
+// compare it with the stored rules
+func (d *Domain) NormalizeRule(p *PathMappingEntry) {
+	if !p.Regex {
+		p.From = d.PathNormalization.rule(p.From, !p.Exact)
+	}
+}
@@ -0,0 +1,471 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/axelspringer/swerve/src/log"
+)
+
+const (
+	// maxInlinePathSize is the encoded size of the path map still stored in the domain item
+	maxInlinePathSize = 200000
+	// maxPathChunkSize is the encoded size of the path rules stored in one paths table item
+	maxPathChunkSize = 300000
+)
+
+var (
+	// ErrDomainNotFound is returned for unknown domains
+	ErrDomainNotFound = errors.New("Domain not found")
+	// ErrConflict is returned when the domain was modified since it was read
+	ErrConflict = errors.New("Domain was modified concurrently")
+)
+
+// ModifiedAt formats the modification date of a change. The conditional writes compare it, so
+// it keeps the nanoseconds to tell apart changes within the same second
+func ModifiedAt(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
+
+// conditionError maps failed write conditions to ErrConflict
+func conditionError(err error) error {
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return ErrConflict
+	}
+	return err
+}
+
+// modifiedCondition adds the condition on the modification date read before the change to the write
+func modifiedCondition(modified string, values map[string]*dynamodb.AttributeValue) *string {
+	values[":e"] = &dynamodb.AttributeValue{S: aws.String(modified)}
+	return aws.String("modified = :e")
+}
+
+// gzipJSON encodes and compresses the value
+func gzipJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// gunzipJSON decompresses and decodes the data into the value
+func gunzipJSON(data []byte, v interface{}) error {
+	reader, err := gzip.NewReader(bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+
+	s, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+
+	if err := reader.Close(); err != nil {
+		return err
+	}
+
+	return json.Unmarshal(s, v)
+}
+
+// chunkPaths splits the path map into chunks with an encoded size below the chunk limit
+func chunkPaths(paths PathList) ([]PathList, error) {
+	res := []PathList{}
+	chunk := PathList{}
+	size := 0
+
+	for _, p := range paths {
+		data, err := json.Marshal(p)
+		if err != nil {
+			return nil, err
+		}
+		if len(chunk) > 0 && size+len(data)+1 > maxPathChunkSize {
+			res = append(res, chunk)
+			chunk = PathList{}
+			size = 0
+		}
+		chunk = append(chunk, p)
+		size += len(data) + 1
+	}
+
+	if len(chunk) > 0 {
+		res = append(res, chunk)
+	}
+
+	return res, nil
+}
+
+// chunkKeys returns the keys of the chunks in the paths table. Former versions numbered the chunks from 0
+func (d *DomainDB) chunkKeys() []int {
+	if len(d.PathChunkKeys) == len(d.PathChunks) {
+		return d.PathChunkKeys
+	}
+
+	keys := make([]int, len(d.PathChunks))
+	for i := range keys {
+		keys[i] = i
+	}
+
+	return keys
+}
+
+// newChunkKeys returns unused keys for new chunks. Stored chunks are never overwritten, the domain
+// item switches to the new chunks in a single write
+func newChunkKeys(count int) []int {
+	if count == 0 {
+		return nil
+	}
+
+	base := int(time.Now().UnixNano() / int64(time.Microsecond))
+	keys := make([]int, count)
+	for i := range keys {
+		keys[i] = base + i
+	}
+
+	return keys
+}
+
+// chunkKey returns the paths table key of a chunk
+func chunkKey(domain string, chunk int) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"domain": {
+			S: aws.String(domain),
+		},
+		"chunk": {
+			N: aws.String(fmt.Sprint(chunk)),
+		},
+	}
+}
+
+// putPathChunk stores a new chunk of the path rules of the domain
+func (d *DynamoDB) putPathChunk(domain string, chunk int, paths PathList) error {
+	data, err := gzipJSON(paths)
+	if err != nil {
+		return err
+	}
+
+	mm, err := dynamodbattribute.MarshalMap(PathChunk{
+		Domain: domain,
+		Chunk:  chunk,
+		Paths:  data,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = d.Service.PutItem(&dynamodb.PutItemInput{
+		Item:                mm,
+		TableName:           aws.String(DBTablePrefix + dbPathsTableName),
+		ConditionExpression: aws.String("attribute_not_exists(#c)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#c": aws.String("chunk"),
+		},
+	})
+
+	return conditionError(err)
+}
+
+// putPathChunks stores the chunks under new keys. Already stored chunks are removed again on errors
+func (d *DynamoDB) putPathChunks(domain string, chunks []PathList) ([]int, error) {
+	keys := newChunkKeys(len(chunks))
+	for i, chunk := range chunks {
+		if err := d.putPathChunk(domain, keys[i], chunk); err != nil {
+			d.discardPathChunks(domain, keys[:i])
+			return nil, err
+		}
+	}
+
+	return keys, nil
+}
+
+// discardPathChunks removes chunks no domain item refers to. Failures only leave unused chunks behind
+func (d *DynamoDB) discardPathChunks(domain string, keys []int) {
+	for _, key := range keys {
+		_, err := d.Service.DeleteItem(&dynamodb.DeleteItemInput{
+			Key:       chunkKey(domain, key),
+			TableName: aws.String(DBTablePrefix + dbPathsTableName),
+		})
+		if err != nil {
+			log.Errorf("Error while deleting path chunk %d of %s. %v", key, domain, err)
+		}
+	}
+}
+
+// fetchPathChunk reads a chunk of the path rules of the domain
+func (d *DynamoDB) fetchPathChunk(domain string, chunk int) (PathList, error) {
+	res, err := d.Service.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(DBTablePrefix + dbPathsTableName),
+		Key:       chunkKey(domain, chunk),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error while getting path chunk. %v", err)
+	}
+	if res.Item == nil {
+		return nil, fmt.Errorf("Missing path chunk %d of %s", chunk, domain)
+	}
+
+	item := PathChunk{}
+	if err = dynamodbattribute.UnmarshalMap(res.Item, &item); err != nil {
+		return nil, err
+	}
+
+	paths := PathList{}
+	if err = gunzipJSON(item.Paths, &paths); err != nil {
+		return nil, err
+	}
+
+	return paths, nil
+}
+
+// loadPathChunks reads the path map of a domain stored in the paths table
+func (d *DynamoDB) loadPathChunks(domaindb *DomainDB) error {
+	if len(domaindb.PathChunks) == 0 {
+		return nil
+	}
+
+	paths := PathList{}
+	for _, key := range domaindb.chunkKeys() {
+		chunk, err := d.fetchPathChunk(domaindb.Name, key)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, chunk...)
+	}
+	domaindb.PathMapping = &paths
+
+	return nil
+}
+
+// pagePaths returns the part of the path map covered by the page
+func pagePaths(paths PathList, offset int, limit int) PathList {
+	if offset >= len(paths) {
+		return PathList{}
+	}
+
+	end := offset + limit
+	if end > len(paths) {
+		end = len(paths)
+	}
+
+	return append(PathList{}, paths[offset:end]...)
+}
+
+// FetchPaths returns a page of the path rules of the domain and the total number of rules.
+// Only the chunks covering the page are read from the paths table
+func (d *DynamoDB) FetchPaths(domain string, offset int, limit int) (PathList, int, error) {
+	domaindb, err := d.fetchDomainDB(domain)
+	if err != nil {
+		return nil, 0, err
+	}
+	if domaindb.ID == "" {
+		return nil, 0, ErrDomainNotFound
+	}
+
+	if len(domaindb.PathChunks) == 0 {
+		stored, err := domaindb.toDomain()
+		if err != nil {
+			return nil, 0, err
+		}
+		if stored.PathMapping == nil {
+			return PathList{}, 0, nil
+		}
+		return pagePaths(*stored.PathMapping, offset, limit), len(*stored.PathMapping), nil
+	}
+
+	res := PathList{}
+	keys := domaindb.chunkKeys()
+	start := 0
+	for i, size := range domaindb.PathChunks {
+		end := start + size
+		if end > offset && start < offset+limit {
+			chunk, err := d.fetchPathChunk(domain, keys[i])
+			if err != nil {
+				return nil, 0, err
+			}
+			for j, p := range chunk {
+				if start+j >= offset && start+j < offset+limit {
+					res = append(res, p)
+				}
+			}
+		}
+		start = end
+	}
+
+	return res, start, nil
+}
+
+// UpdatePath stores the domain after a change of the path rule at the index. For path maps in
+// the paths table only the chunk holding the rule is rewritten. The write fails with ErrConflict
+// when the stored domain isn't modified at the given date anymore
+func (d *DynamoDB) UpdatePath(domain Domain, index int, modified string) error {
+	domaindb, err := d.fetchDomainDB(domain.Name)
+	if err != nil {
+		return err
+	}
+	if domaindb.Modified != modified {
+		return ErrConflict
+	}
+
+	total := 0
+	for _, size := range domaindb.PathChunks {
+		total += size
+	}
+
+	// inline path maps and changed layouts are stored completely
+	if len(domaindb.PathChunks) == 0 || domain.PathMapping == nil || len(*domain.PathMapping) != total {
+		return d.insertDomain(domain, modified)
+	}
+
+	keys := domaindb.chunkKeys()
+	start := 0
+	for i, size := range domaindb.PathChunks {
+		if index >= start+size {
+			start += size
+			continue
+		}
+
+		chunk := (*domain.PathMapping)[start : start+size]
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			return err
+		}
+		if len(data) > maxPathChunkSize {
+			return d.insertDomain(domain, modified)
+		}
+
+		added, err := d.putPathChunks(domain.Name, []PathList{chunk})
+		if err != nil {
+			return err
+		}
+
+		newKeys := append(append(append([]int{}, keys[:i]...), added...), keys[i+1:]...)
+		return d.switchPathChunks(domain, modified, domaindb.PathChunks, newKeys, added, keys[i:i+1])
+	}
+
+	return d.insertDomain(domain, modified)
+}
+
+// UpdatePaths stores the domain after a change of the path rules starting at the index, e.g.
+// after adding or deleting rules. For path maps in the paths table only the chunks from the one
+// holding the first changed rule on are rewritten. The write fails with ErrConflict when the
+// stored domain isn't modified at the given date anymore
+func (d *DynamoDB) UpdatePaths(domain Domain, first int, modified string) error {
+	domaindb, err := d.fetchDomainDB(domain.Name)
+	if err != nil {
+		return err
+	}
+	if domaindb.Modified != modified {
+		return ErrConflict
+	}
+
+	if len(domaindb.PathChunks) == 0 || domain.PathMapping == nil {
+		return d.insertDomain(domain, modified)
+	}
+
+	// keep the chunks in front of the first change
+	chunk := 0
+	start := 0
+	for chunk < len(domaindb.PathChunks)-1 && start+domaindb.PathChunks[chunk] <= first {
+		start += domaindb.PathChunks[chunk]
+		chunk++
+	}
+	if start > len(*domain.PathMapping) {
+		return d.insertDomain(domain, modified)
+	}
+
+	chunks, err := chunkPaths((*domain.PathMapping)[start:])
+	if err != nil {
+		return err
+	}
+
+	added, err := d.putPathChunks(domain.Name, chunks)
+	if err != nil {
+		return err
+	}
+
+	sizes := append([]int{}, domaindb.PathChunks[:chunk]...)
+	for _, paths := range chunks {
+		sizes = append(sizes, len(paths))
+	}
+
+	keys := domaindb.chunkKeys()
+	return d.switchPathChunks(domain, modified, sizes, append(append([]int{}, keys[:chunk]...), added...), added, keys[chunk:])
+}
+
+// switchPathChunks points the domain item still modified at the former date to the chunks and
+// removes the replaced chunks. The added chunks are removed again if the domain item isn't changed
+func (d *DynamoDB) switchPathChunks(domain Domain, modified string, sizes []int, keys []int, added []int, replaced []int) error {
+	sizesAttr, err := dynamodbattribute.Marshal(sizes)
+	if err != nil {
+		d.discardPathChunks(domain.Name, added)
+		return err
+	}
+
+	keysAttr, err := dynamodbattribute.Marshal(keys)
+	if err != nil {
+		d.discardPathChunks(domain.Name, added)
+		return err
+	}
+
+	values := map[string]*dynamodb.AttributeValue{
+		":p": sizesAttr,
+		":k": keysAttr,
+		":m": {
+			S: aws.String(domain.Modified),
+		},
+	}
+	_, err = d.Service.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(DBTablePrefix + dbDomainTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"domain": {
+				S: aws.String(domain.Name),
+			},
+		},
+		UpdateExpression:          aws.String("set path_chunks = :p, path_chunk_keys = :k, modified = :m"),
+		ConditionExpression:       modifiedCondition(modified, values),
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		d.discardPathChunks(domain.Name, added)
+		return conditionError(err)
+	}
+
+	d.discardPathChunks(domain.Name, replaced)
+
+	return nil
+}
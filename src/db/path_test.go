@@ -0,0 +1,222 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/axelspringer/swerve/src/db/dbtest"
+
+	"github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// sizedPath returns a path rule with the given encoded size
+func sizedPath(i int, size int) PathMappingEntry {
+	entry := PathMappingEntry{From: fmt.Sprintf("/%d/", i), To: "/new"}
+	data, _ := json.Marshal(entry)
+	entry.From += strings.Repeat("a", size-len(data))
+
+	data, _ = json.Marshal(entry)
+	Expect(data).To(HaveLen(size))
+
+	return entry
+}
+
+// sizedPaths returns count path rules with the given encoded size
+func sizedPaths(count int, size int) PathList {
+	paths := PathList{}
+	for i := 0; i < count; i++ {
+		paths = append(paths, sizedPath(i, size))
+	}
+	return paths
+}
+
+// chunkedDomain returns a domain with five path rules stored in chunks of two rules
+func chunkedDomain() Domain {
+	paths := sizedPaths(5, 100000)
+	return Domain{
+		ID:          "1",
+		Name:        "chunked.example.com",
+		Redirect:    "https://www.example.com/",
+		Modified:    "2019-01-01T00:00:00Z",
+		PathMapping: &paths,
+	}
+}
+
+var _ = ginkgo.Describe("Path chunks", func() {
+	ginkgo.It("Chunk paths filling a chunk exactly", func() {
+		// every rule adds its encoded size and one separator byte
+		chunks, err := chunkPaths(sizedPaths(2, maxPathChunkSize/2-1))
+		Expect(err).To(BeNil())
+		Expect(chunks).To(HaveLen(1))
+		Expect(chunks[0]).To(HaveLen(2))
+	})
+
+	ginkgo.It("Chunk paths exceeding a chunk by one byte", func() {
+		chunks, err := chunkPaths(sizedPaths(2, maxPathChunkSize/2))
+		Expect(err).To(BeNil())
+		Expect(chunks).To(HaveLen(2))
+		Expect(chunks[0]).To(HaveLen(1))
+		Expect(chunks[1]).To(HaveLen(1))
+	})
+
+	ginkgo.It("Chunk paths keeps a rule larger than the limit in its own chunk", func() {
+		paths := append(sizedPaths(1, 100), sizedPath(1, maxPathChunkSize+10), sizedPath(2, 100))
+		chunks, err := chunkPaths(paths)
+		Expect(err).To(BeNil())
+		Expect(chunks).To(HaveLen(3))
+	})
+
+	ginkgo.It("Domain keeps path maps up to the inline limit in the item", func() {
+		// the list adds two brackets and one comma per additional rule
+		paths := sizedPaths(2, maxInlinePathSize/2-2)
+		domain := Domain{Name: "inline.example.com", PathMapping: &paths}
+		domaindb, chunks, err := domain.toDomainDB()
+		Expect(err).To(BeNil())
+		Expect(chunks).To(BeNil())
+		Expect(domaindb.PathMapping).To(Equal(&paths))
+
+		paths = sizedPaths(2, maxInlinePathSize/2-1)
+		domain.PathMapping = &paths
+		domaindb, chunks, err = domain.toDomainDB()
+		Expect(err).To(BeNil())
+		Expect(chunks).To(HaveLen(1))
+		Expect(domaindb.PathMapping).To(BeNil())
+		Expect(domaindb.PathChunks).To(Equal([]int{2}))
+	})
+
+	ginkgo.It("Fetch paths reads pages across chunk boundaries", func() {
+		fake := dbtest.NewFakeDynamo()
+		d := &DynamoDB{Service: fake}
+		Expect(d.InsertDomain(chunkedDomain())).To(BeNil())
+		Expect(fake.ChunkCount()).To(Equal(3))
+
+		paths, total, err := d.FetchPaths("chunked.example.com", 1, 3)
+		Expect(err).To(BeNil())
+		Expect(total).To(Equal(5))
+		Expect(paths).To(Equal((*chunkedDomain().PathMapping)[1:4]))
+
+		paths, total, err = d.FetchPaths("chunked.example.com", 4, 10)
+		Expect(err).To(BeNil())
+		Expect(total).To(Equal(5))
+		Expect(paths).To(HaveLen(1))
+
+		_, _, err = d.FetchPaths("unknown.example.com", 0, 10)
+		Expect(err).To(Equal(ErrDomainNotFound))
+	})
+
+	ginkgo.It("Insert domain replaces the chunks of the former path map", func() {
+		fake := dbtest.NewFakeDynamo()
+		d := &DynamoDB{Service: fake}
+		domain := chunkedDomain()
+		Expect(d.InsertDomain(domain)).To(BeNil())
+
+		paths := (*domain.PathMapping)[:3]
+		domain.PathMapping = &paths
+		Expect(d.InsertDomain(domain)).To(BeNil())
+		Expect(fake.ChunkCount()).To(Equal(2))
+
+		stored, err := d.FetchByDomain(domain.Name)
+		Expect(err).To(BeNil())
+		Expect(*stored.PathMapping).To(Equal(paths))
+	})
+
+	ginkgo.It("Update paths of a domain modified concurrently keeps the stored paths", func() {
+		fake := dbtest.NewFakeDynamo()
+		d := &DynamoDB{Service: fake}
+		domain := chunkedDomain()
+		Expect(d.InsertDomain(domain)).To(BeNil())
+
+		paths := append(PathList{}, (*domain.PathMapping)...)
+		paths[4].To = "/changed"
+		changed := domain
+		changed.PathMapping = &paths
+		changed.Modified = "2019-01-02T00:00:00Z"
+		Expect(d.UpdatePath(changed, 4, "2018-12-31T00:00:00Z")).To(Equal(ErrConflict))
+		Expect(fake.ChunkCount()).To(Equal(3))
+
+		Expect(d.UpdatePath(changed, 4, domain.Modified)).To(BeNil())
+		Expect(fake.ChunkCount()).To(Equal(3))
+
+		stored, err := d.FetchByDomain(domain.Name)
+		Expect(err).To(BeNil())
+		Expect(*stored.PathMapping).To(Equal(paths))
+		Expect(stored.Modified).To(Equal(changed.Modified))
+
+	})
+
+	ginkgo.It("Update paths changed after reading the domain discards the new chunks", func() {
+		fake := dbtest.NewFakeDynamo()
+		d := &DynamoDB{Service: fake}
+		domain := chunkedDomain()
+		Expect(d.InsertDomain(domain)).To(BeNil())
+
+		fake.BeforeWrite = func(item map[string]*dynamodb.AttributeValue) {
+			item["modified"] = &dynamodb.AttributeValue{S: aws.String("2019-01-03T00:00:00Z")}
+		}
+
+		paths := (*domain.PathMapping)[:1]
+		changed := domain
+		changed.PathMapping = &paths
+		Expect(d.UpdatePaths(changed, 1, domain.Modified)).To(Equal(ErrConflict))
+		Expect(fake.ChunkCount()).To(Equal(3))
+
+		stored, err := d.FetchByDomain(domain.Name)
+		Expect(err).To(BeNil())
+		Expect(*stored.PathMapping).To(Equal(*domain.PathMapping))
+	})
+
+	ginkgo.It("Delete domain removes its chunks without using the paths table for inline path maps", func() {
+		fake := dbtest.NewFakeDynamo()
+		d := &DynamoDB{Service: fake}
+		Expect(d.InsertDomain(chunkedDomain())).To(BeNil())
+
+		paths := sizedPaths(1, 100)
+		Expect(d.InsertDomain(Domain{ID: "2", Name: "inline.example.com", PathMapping: &paths})).To(BeNil())
+
+		// the fake has no query, inline domains must not read the paths table
+		deleted, err := d.DeleteByDomain("inline.example.com")
+		Expect(err).To(BeNil())
+		Expect(deleted).To(BeTrue())
+		Expect(fake.ChunkCount()).To(Equal(3))
+
+		deleted, err = d.DeleteByDomain("chunked.example.com")
+		Expect(err).To(BeNil())
+		Expect(deleted).To(BeTrue())
+		Expect(fake.ChunkCount()).To(Equal(0))
+	})
+
+	ginkgo.It("Update paths twice within a second from the same read conflicts", func() {
+		d := &DynamoDB{Service: dbtest.NewFakeDynamo()}
+		now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+		domain := chunkedDomain()
+		domain.Modified = ModifiedAt(now)
+		Expect(d.InsertDomain(domain)).To(BeNil())
+
+		first := domain
+		first.Modified = ModifiedAt(now.Add(100 * time.Millisecond))
+		Expect(d.UpdatePath(first, 0, domain.Modified)).To(BeNil())
+
+		second := domain
+		second.Modified = ModifiedAt(now.Add(200 * time.Millisecond))
+		Expect(d.UpdatePath(second, 0, domain.Modified)).To(Equal(ErrConflict))
+	})
+})
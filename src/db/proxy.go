@@ -0,0 +1,78 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"net/url"
+	"strings"
+)
+
+// valid checks the upstream and the host header of the proxy
+func (p *Proxy) valid() bool {
+	if p == nil || !isAbsoluteURL(p.Upstream) || p.Timeout < 0 {
+		return false
+	}
+
+	upstream, err := url.Parse(p.Upstream)
+	if err != nil || upstream.Host == "" || upstream.Fragment != "" {
+		return false
+	}
+
+	if p.Host != "" {
+		if p.PreserveHost {
+			return false
+		}
+		host, err := url.Parse("//" + p.Host)
+		if err != nil || host.Host != p.Host {
+			return false
+		}
+	}
+
+	return true
+}
+
+// proxy returns the decision forwarding the request to the upstream of the rule, or of
+// the domain when the rule is nil. The request path is appended to the upstream path
+func (r *request) proxy(d *Domain, p *PathMappingEntry) *Decision {
+	proxy := d.Proxy
+	forward := r.path
+	if p != nil {
+		proxy = p.Proxy
+		if proxy.StripPrefix {
+			if p.Regex {
+				forward = r.rest
+			} else if r.hasPrefix(p.From, false) {
+				forward = r.restPath(p.From)
+			}
+		}
+	}
+
+	upstream, _ := url.Parse(proxy.Upstream)
+	location := strings.TrimSuffix(upstream.Scheme+"://"+upstream.Host+upstream.EscapedPath(), "/") +
+		"/" + strings.TrimPrefix(forward, "/")
+
+	switch {
+	case upstream.RawQuery != "" && r.rawQuery != "":
+		location += "?" + upstream.RawQuery + "&" + r.rawQuery
+	case upstream.RawQuery != "" || r.rawQuery != "":
+		location += "?" + upstream.RawQuery + r.rawQuery
+	}
+
+	return &Decision{
+		Action:   ActionProxy,
+		Location: location,
+		Proxy:    proxy,
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"net/url"
+)
+
+const (
+	// QueryKeep passes all request parameters to the target
+	QueryKeep = "keep"
+	// QueryDrop removes all request parameters
+	QueryDrop = "drop"
+	// QueryAllowlist passes only the listed request parameters
+	QueryAllowlist = "allowlist"
+	// QueryDenylist passes all request parameters except the listed ones
+	QueryDenylist = "denylist"
+)
+
+// valid checks the policy definition
+func (q *QueryPolicy) valid() bool {
+	switch q.Mode {
+	case "", QueryKeep, QueryDrop:
+		return true
+	case QueryAllowlist, QueryDenylist:
+		return len(q.Params) > 0
+	}
+
+	return false
+}
+
+// apply filters, renames and extends the request parameters. Without a mode the
+// request parameters are passed only when the domain is promotable
+func (q *QueryPolicy) apply(query url.Values, promotable bool) url.Values {
+	res := url.Values{}
+	listed := map[string]bool{}
+	for _, p := range q.Params {
+		listed[p] = true
+	}
+
+	for name, values := range query {
+		pass := false
+		switch q.Mode {
+		case "":
+			pass = promotable
+		case QueryKeep:
+			pass = true
+		case QueryAllowlist:
+			pass = listed[name]
+		case QueryDenylist:
+			pass = !listed[name]
+		}
+		if !pass {
+			continue
+		}
+		if newName, ok := q.Rename[name]; ok {
+			name = newName
+		}
+		res[name] = append(res[name], values...)
+	}
+
+	for name, value := range q.Set {
+		res.Set(name, value)
+	}
+
+	return res
+}
+
+// withQuery merges the parameters into the query of the target location
+func withQuery(location string, params url.Values) string {
+	target, err := url.Parse(location)
+	if err != nil {
+		return location
+	}
+
+	query := target.Query()
+	for name, values := range params {
+		query[name] = values
+	}
+	target.RawQuery = query.Encode()
+
+	return target.String()
+}
@@ -0,0 +1,200 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// isAbsoluteURL checks for a http or https target
+func isAbsoluteURL(target string) bool {
+	return strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://")
+}
+
+// isEmpty checks for a path mapping entry without target
+func (p *PathMappingEntry) isEmpty() bool {
+	return p.To == "" && len(p.Targets) == 0 && !p.isResponse()
+}
+
+// match returns the first path mapping entry matching the request
+func (d *Domain) match(req *request) *PathMappingEntry {
+	if d.PathMapping == nil {
+		return nil
+	}
+
+	// the compiled index is only used for the path mapping it was built from
+	if d.index != nil && d.index.paths == d.PathMapping {
+		return d.index.match(req)
+	}
+
+	for i := range *d.PathMapping {
+		p := &(*d.PathMapping)[i]
+		// skip empty and inactive path mapping
+		if p.isEmpty() || !p.IsActive(req.time) {
+			continue
+		}
+		// we match the path prefix and the request conditions
+		if p.matches(req) {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// GetRedirect returns calculated routes
+func (d *Domain) GetRedirect(r *http.Request) (string, int) {
+	decision := d.Resolve(r)
+	return decision.Location, decision.Code
+}
+
+// Resolve calculates the redirect decision for the request including the response headers
+func (d *Domain) Resolve(r *http.Request) *Decision {
+	res := d.resolve(r)
+	res.Headers = d.ResponseHeader(res.Rule)
+	return res
+}
+
+// resolve calculates the redirect decision for the request
+func (d *Domain) resolve(r *http.Request) *Decision {
+	req := newRequest(r, d)
+	if !d.IsActive(req.time) {
+		return inactiveDecision()
+	}
+
+	reqURL := r.URL
+	res := &Decision{Code: d.RedirectCode}
+	reURL := d.Redirect
+	rePath := ""
+	reQuery := ""
+	reqPath := req.path
+	policy := d.QueryPolicy
+	p := d.match(req)
+
+	// proxied requests of the matched rule or the domain
+	if p != nil && p.Action == ActionProxy {
+		res = req.proxy(d, p)
+		res.Rule = p
+		return res
+	}
+	if p == nil && d.Action == ActionProxy {
+		return req.proxy(d, nil)
+	}
+
+	// non redirect actions of the matched rule or the domain
+	if p != nil && p.isResponse() {
+		res = p.Response.decision()
+		res.Rule = p
+		return res
+	}
+	if p == nil && d.isResponse() {
+		return d.Response.decision()
+	}
+
+	// unmatched paths of non promotable domains can get a not found response
+	if p == nil && d.NotFound != nil && !d.Promotable && reqPath != "/" && reqPath != "" {
+		return d.notFoundDecision()
+	}
+
+	// the domain split picks the default redirect unless the matched rule splits itself or
+	// replaces the redirect with an absolute target
+	if len(d.Targets) > 0 && (p == nil || (len(p.Targets) == 0 && !isAbsoluteTemplate(p.To))) {
+		reURL = req.split(res, d, "", d.Targets)
+	}
+
+	// templated targets are complete, the request path and query are only added through variables
+	complete := isTemplate(reURL)
+	base := reURL
+
+	// relative path rules of a templated domain are based on its origin
+	if complete {
+		reURL = req.expand(reURL, d)
+		if target, err := url.Parse(reURL); err == nil {
+			base = target.Scheme + "://" + target.Host
+		}
+	}
+
+	if d.Promotable == true {
+		rePath = reqURL.Path
+
+		if len(reqURL.RawQuery) > 0 {
+			reQuery = "?" + reqURL.RawQuery
+		}
+	}
+
+	if p != nil {
+		res.Rule = p
+		to := p.To
+		if len(p.Targets) > 0 {
+			to = req.split(res, d, p.From, p.Targets)
+		}
+
+		complete = false
+		if p.Regex {
+			rePath = req.rest
+		} else if req.hasPrefix(p.From, false) {
+			rePath = req.restPath(p.From)
+		} else {
+			rePath = p.From
+		}
+		// templated redirect, relative templates are based on the domain redirect
+		if isTemplate(to) {
+			complete = true
+			if isAbsoluteTemplate(to) {
+				reURL = req.expand(to, d)
+			} else {
+				reURL = strings.TrimSuffix(base, "/") + req.expand(to, d)
+			}
+		} else if isAbsoluteURL(to) {
+			// path redirect
+			reURL = to
+		} else {
+			reURL = base
+			if d.Promotable {
+				rePath = path.Join(to, rePath)
+			} else {
+				rePath = to
+			}
+		}
+		// rule code overrides the domain one
+		if p.Code != 0 {
+			res.Code = p.Code
+		}
+		// rule query policy overrides the domain one
+		if p.QueryPolicy != nil {
+			policy = p.QueryPolicy
+		}
+	}
+
+	if complete {
+		rePath = ""
+		reQuery = ""
+	}
+
+	if strings.HasSuffix(reURL, "/") && strings.HasPrefix(rePath, "/") {
+		rePath = strings.TrimLeft(rePath, "/")
+	}
+
+	if policy != nil {
+		res.Location = withQuery(reURL+rePath, policy.apply(req.query, d.Promotable))
+	} else {
+		res.Location = reURL + rePath + reQuery
+	}
+
+	return res
+}
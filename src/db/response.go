@@ -0,0 +1,98 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"net/http"
+)
+
+const (
+	// ActionRedirect redirects the request, the default action
+	ActionRedirect = "redirect"
+	// ActionStatus responds with the status code only
+	ActionStatus = "status"
+	// ActionStatic responds with the status code and a static body
+	ActionStatic = "static"
+	// ActionProxy forwards the request to an upstream
+	ActionProxy = "proxy"
+)
+
+const (
+	defaultStaticContentType = "text/html; charset=utf-8"
+)
+
+// isResponse checks for a non redirect action
+func (r *Response) isResponse() bool {
+	return r.Action == ActionStatus || r.Action == ActionStatic || r.Action == ActionProxy
+}
+
+// validAction checks the action name
+func (r *Response) validAction() bool {
+	switch r.Action {
+	case "", ActionRedirect, ActionStatus, ActionStatic, ActionProxy:
+		return true
+	}
+	return false
+}
+
+// validResponse checks the status of a non redirect action. Redirect codes need a location
+// and are not allowed here
+func (r *Response) validResponse() bool {
+	if r.Action == ActionStatic && r.Status == 0 {
+		return true
+	}
+
+	return r.Status >= 200 && r.Status <= 599 && (r.Status < 300 || r.Status > 399)
+}
+
+// decision returns the response of the non redirect action
+func (r *Response) decision() *Decision {
+	res := &Decision{
+		Action: r.Action,
+		Code:   r.Status,
+		Body:   r.Body,
+	}
+
+	if r.Action == ActionStatic {
+		res.ContentType = r.ContentType
+		if res.ContentType == "" {
+			res.ContentType = defaultStaticContentType
+		}
+		if res.Code == 0 {
+			res.Code = http.StatusOK
+		}
+	}
+
+	return res
+}
+
+// validNotFound checks the not found response of a domain. Without a status it responds with 404
+func (r *Response) validNotFound() bool {
+	if r.Action != ActionStatus && r.Action != ActionStatic {
+		return false
+	}
+
+	return r.Status == 0 || r.validResponse()
+}
+
+// notFoundDecision returns the not found response of the domain
+func (d *Domain) notFoundDecision() *Decision {
+	res := d.NotFound.decision()
+	if d.NotFound.Status == 0 {
+		res.Code = http.StatusNotFound
+	}
+
+	return res
+}
@@ -0,0 +1,59 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+const (
+	// RulePrefix matches the path and query string prefix
+	RulePrefix = "prefix"
+	// RuleExact matches the path or the path and query string exactly
+	RuleExact = "exact"
+	// RuleRegex matches the path with a regular expression
+	RuleRegex = "regex"
+	// RuleConditional matches the path prefix and request conditions
+	RuleConditional = "conditional"
+)
+
+// Type returns the kind of matching of the path rule
+func (p *PathMappingEntry) Type() string {
+	switch {
+	case p.Regex:
+		return RuleRegex
+	case p.Exact:
+		return RuleExact
+	case p.hasConditions():
+		return RuleConditional
+	}
+
+	return RulePrefix
+}
+
+// RuleIndex returns the stored position of a path rule of the domain or -1 for foreign rules
+func (d *Domain) RuleIndex(p *PathMappingEntry) int {
+	if p == nil || d.PathMapping == nil {
+		return -1
+	}
+
+	if p.position > 0 {
+		return p.position - 1
+	}
+
+	for i := range *d.PathMapping {
+		if &(*d.PathMapping)[i] == p {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,124 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"net/http"
+	"sort"
+	"time"
+)
+
+// parseWindowTime parses an optional window boundary
+func parseWindowTime(s string) (time.Time, bool, error) {
+	if s == "" {
+		return time.Time{}, false, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	return t, true, nil
+}
+
+// validWindow checks the format and the order of the window boundaries
+func validWindow(from string, until string) bool {
+	f, hasFrom, err := parseWindowTime(from)
+	if err != nil {
+		return false
+	}
+
+	u, hasUntil, err := parseWindowTime(until)
+	if err != nil {
+		return false
+	}
+
+	return !hasFrom || !hasUntil || f.Before(u)
+}
+
+// activeWindow checks the time against the window. Unparsable boundaries are ignored
+func activeWindow(from string, until string, t time.Time) bool {
+	if f, ok, err := parseWindowTime(from); err == nil && ok && t.Before(f) {
+		return false
+	}
+
+	if u, ok, err := parseWindowTime(until); err == nil && ok && !t.Before(u) {
+		return false
+	}
+
+	return true
+}
+
+// expiredWindow checks whether the window ended before the time
+func expiredWindow(until string, t time.Time) bool {
+	u, ok, err := parseWindowTime(until)
+	return err == nil && ok && !t.Before(u)
+}
+
+// IsActive checks the validity window of the domain
+func (d *Domain) IsActive(t time.Time) bool {
+	return activeWindow(d.ValidFrom, d.ValidUntil, t)
+}
+
+// IsExpired checks whether the validity window of the domain ended
+func (d *Domain) IsExpired(t time.Time) bool {
+	return expiredWindow(d.ValidUntil, t)
+}
+
+// IsActive checks the validity window of the path rule
+func (p *PathMappingEntry) IsActive(t time.Time) bool {
+	return activeWindow(p.ValidFrom, p.ValidUntil, t)
+}
+
+// IsExpired checks whether the validity window of the path rule ended
+func (p *PathMappingEntry) IsExpired(t time.Time) bool {
+	return expiredWindow(p.ValidUntil, t)
+}
+
+// WithoutExpiredPaths returns a copy of the domain without the expired path rules
+// and the number of removed rules. The remaining rules of a sorted domain get back
+// their stored order, so the copy can be stored again
+func (d Domain) WithoutExpiredPaths(t time.Time) (Domain, int) {
+	if d.PathMapping == nil {
+		return d, 0
+	}
+
+	paths := PathList{}
+	for _, p := range *d.PathMapping {
+		if !p.IsExpired(t) {
+			paths = append(paths, p)
+		}
+	}
+	sort.SliceStable(paths, func(i, j int) bool {
+		return paths[i].position < paths[j].position
+	})
+	for i := range paths {
+		paths[i].position = 0
+	}
+	removed := len(*d.PathMapping) - len(paths)
+	d.PathMapping = &paths
+
+	return d, removed
+}
+
+// inactiveDecision returns the configured response for domains outside their validity window
+func inactiveDecision() *Decision {
+	if InactiveRedirect != "" {
+		return &Decision{Location: InactiveRedirect, Code: http.StatusFound}
+	}
+
+	return &Decision{Action: ActionStatus, Code: http.StatusGone}
+}
@@ -9,6 +9,11 @@ func (d *Domain) sortPathMap() {
 	if d.PathMapping == nil {
 		return
 	}
+	d.normalizePaths()
+	// keep the stored position of the rules
+	for i := range *d.PathMapping {
+		(*d.PathMapping)[i].position = i + 1
+	}
 	fr = func(p1, p2 *PathMappingEntry) bool {
 		return len(p1.From) > len(p2.From)
 	}
@@ -25,12 +30,13 @@ type pathMapSorter struct {
 type By func(p1, p2 *PathMappingEntry) bool
 
 // Sort is a method on the function type, By, that sorts the argument slice according to the function.
+// The sort is stable, so entries sharing a prefix keep the order of their conditions
 func (by By) Sort(paths PathList) {
 	ps := &pathMapSorter{
 		paths: paths,
 		by:    by,
 	}
-	sort.Sort(ps)
+	sort.Stable(ps)
 }
 
 // Len is part of sort.Interface
@@ -0,0 +1,111 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strconv"
+)
+
+const (
+	splitCookiePrefix = "swerve_split_"
+	splitCookieMaxAge = 30 * 24 * 60 * 60
+)
+
+// splitCookieName returns the cookie name of the split of a domain or a path rule
+func splitCookieName(domain string, rule string) string {
+	h := fnv.New32a()
+	h.Write([]byte(domain + "|" + rule))
+	return fmt.Sprintf("%s%08x", splitCookiePrefix, h.Sum32())
+}
+
+// variantName returns the name of the target or its position
+func variantName(targets []WeightedTarget, i int) string {
+	if targets[i].Name != "" {
+		return targets[i].Name
+	}
+	return strconv.Itoa(i)
+}
+
+// validTargets checks the weighted targets of a split. Path rules may split to relative targets
+func validTargets(targets []WeightedTarget, captures *regexp.Regexp, relative bool) bool {
+	total := 0
+	names := map[string]bool{}
+
+	for i, t := range targets {
+		name := variantName(targets, i)
+		if t.URL == "" || t.Weight < 0 || names[name] || !validTarget(t.URL, relative) || !validTemplate(t.URL, captures) {
+			return false
+		}
+		names[name] = true
+		total += t.Weight
+	}
+
+	return total > 0
+}
+
+// isTemporaryRedirectCode checks for codes browsers don't cache permanently
+func isTemporaryRedirectCode(code int) bool {
+	return code == http.StatusFound || code == http.StatusSeeOther || code == http.StatusTemporaryRedirect
+}
+
+// split picks the target of a weighted split. A visitor keeps the variant stored in the split cookie
+func (r *request) split(res *Decision, d *Domain, rule string, targets []WeightedTarget) string {
+	name := splitCookieName(d.Name, rule)
+	chosen := -1
+
+	if c, err := r.Cookie(name); err == nil {
+		for i := range targets {
+			if variantName(targets, i) == c.Value && targets[i].Weight > 0 {
+				chosen = i
+				break
+			}
+		}
+	}
+
+	if chosen < 0 {
+		total := 0
+		for _, t := range targets {
+			total += t.Weight
+		}
+		if total <= 0 {
+			return targets[0].URL
+		}
+		n := rand.Intn(total)
+		for i, t := range targets {
+			if n < t.Weight {
+				chosen = i
+				break
+			}
+			n -= t.Weight
+		}
+	}
+
+	res.Split = rule
+	res.Variant = variantName(targets, chosen)
+	res.Cookie = &http.Cookie{
+		Name:     name,
+		Value:    res.Variant,
+		Path:     "/",
+		MaxAge:   splitCookieMaxAge,
+		HttpOnly: true,
+	}
+
+	return targets[chosen].URL
+}
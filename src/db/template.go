@@ -0,0 +1,179 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+var (
+	templatePattern = regexp.MustCompile(`\{([A-Za-z0-9_]+)\}`)
+	labelPattern    = regexp.MustCompile(`^label([1-9][0-9]*)$`)
+)
+
+// isTemplate checks the redirect target for template variables
+func isTemplate(target string) bool {
+	return templatePattern.MatchString(target)
+}
+
+// isAbsoluteTemplate checks for a template with a fixed or the request scheme
+func isAbsoluteTemplate(target string) bool {
+	return isAbsoluteURL(target) || strings.HasPrefix(target, "{scheme}://")
+}
+
+// validTemplate checks that every variable of the template is known. Captures are
+// only known when the target belongs to a regex path rule
+func validTemplate(target string, captures *regexp.Regexp) bool {
+	for _, m := range templatePattern.FindAllStringSubmatch(target, -1) {
+		switch name := m[1]; {
+		case name == "host", name == "subdomain", name == "scheme", name == "path", name == "query":
+		case labelPattern.MatchString(name):
+		case captures == nil:
+			return false
+		default:
+			if !validCapture(name, captures) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// captures returns the regex providing the capture variables of the path rule
+func (p *PathMappingEntry) captures() *regexp.Regexp {
+	if !p.Regex {
+		return nil
+	}
+
+	re, err := compilePattern(p.From)
+	if err != nil {
+		return nil
+	}
+
+	return re
+}
+
+// validTemplate checks the template of the path rule target against the From regex
+func (p *PathMappingEntry) validTemplate() bool {
+	return validTemplate(p.To, p.captures())
+}
+
+// validCapture checks a numbered or named capture group of the regex
+func validCapture(name string, re *regexp.Regexp) bool {
+	if i, err := strconv.Atoi(name); err == nil {
+		return i > 0 && i <= re.NumSubexp()
+	}
+
+	for _, n := range re.SubexpNames() {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// subdomain returns the part of the host in front of the domain. For wildcard domains
+// the domain is the wildcard base, otherwise the registered domain
+func (r *request) subdomain(d *Domain) string {
+	base := strings.TrimPrefix(d.Name, WildcardPrefix)
+	if !d.Wildcard {
+		if registered, err := publicsuffix.EffectiveTLDPlusOne(r.host); err == nil {
+			base = registered
+		}
+	}
+
+	if !strings.HasSuffix(r.host, "."+base) {
+		return ""
+	}
+
+	return strings.TrimSuffix(r.host, "."+base)
+}
+
+// scheme of the request
+func (r *request) scheme() string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// variable returns the escaped value of a template variable. Values in the query
+// part of the target are query escaped, values in front of it keep the path escaping
+func (r *request) variable(name string, d *Domain, inQuery bool) string {
+	escape := func(s string) string {
+		if inQuery {
+			return url.QueryEscape(s)
+		}
+		return s
+	}
+
+	switch name {
+	case "host":
+		return escape(r.host)
+	case "subdomain":
+		return escape(r.subdomain(d))
+	case "scheme":
+		return r.scheme()
+	case "path":
+		if inQuery {
+			return url.QueryEscape(r.URL.Path)
+		}
+		return r.path
+	case "query":
+		return r.rawQuery
+	}
+
+	if m := labelPattern.FindStringSubmatch(name); m != nil {
+		labels := strings.Split(r.host, ".")
+		if i, _ := strconv.Atoi(m[1]); i <= len(labels) {
+			return escape(labels[i-1])
+		}
+		return ""
+	}
+
+	// captures are taken from the escaped path
+	value := r.captures[name]
+	if inQuery {
+		if unescaped, err := url.PathUnescape(value); err == nil {
+			return url.QueryEscape(unescaped)
+		}
+	}
+
+	return value
+}
+
+// expand replaces the template variables of the target with the request values
+func (r *request) expand(target string, d *Domain) string {
+	var b strings.Builder
+	queryAt := strings.Index(target, "?")
+	last := 0
+
+	for _, m := range templatePattern.FindAllStringSubmatchIndex(target, -1) {
+		b.WriteString(target[last:m[0]])
+		inQuery := queryAt >= 0 && m[0] > queryAt
+		b.WriteString(r.variable(target[m[2]:m[3]], d, inQuery))
+		last = m[1]
+	}
+	b.WriteString(target[last:])
+
+	return b.String()
+}
@@ -15,14 +15,17 @@
 package db
 
 import (
+	"net"
+	"net/http"
+
 	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 )
 
 // DynamoDB model
 type DynamoDB struct {
 	Session *session.Session
-	Service *dynamodb.DynamoDB
+	Service dynamodbiface.DynamoDBAPI
 }
 
 // DynamoConnection model
@@ -34,15 +37,116 @@ type DynamoConnection struct {
 	Region    string
 }
 
+// GeoLocator resolves the ISO country code and the continent code of an ip address
+type GeoLocator interface {
+	Lookup(ip net.IP) (string, string)
+}
+
 // DomainList db entry
 type DomainList struct {
 	Domains []Domain `json:"domains"`
 }
 
+// QueryCondition model
+type QueryCondition struct {
+	Param string `json:"param"`
+	Match string `json:"match"`
+	Value string `json:"value"`
+}
+
+// HeaderCondition model
+type HeaderCondition struct {
+	Header string `json:"header"`
+	Match  string `json:"match"`
+	Value  string `json:"value"`
+}
+
+// CookieCondition model
+type CookieCondition struct {
+	Cookie string `json:"cookie"`
+	Match  string `json:"match"`
+	Value  string `json:"value"`
+}
+
+// WeightedTarget model
+type WeightedTarget struct {
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+// QueryPolicy model
+type QueryPolicy struct {
+	Mode   string            `json:"mode"`
+	Params []string          `json:"params,omitempty"`
+	Rename map[string]string `json:"rename,omitempty"`
+	Set    map[string]string `json:"set,omitempty"`
+}
+
+// Proxy model of the reverse proxy action
+type Proxy struct {
+	Upstream     string `json:"upstream"`
+	Host         string `json:"host,omitempty"`
+	PreserveHost bool   `json:"preserve_host,omitempty"`
+	StripPrefix  bool   `json:"strip_prefix,omitempty"`
+	Timeout      int    `json:"timeout,omitempty"`
+}
+
+// HSTS model of the Strict-Transport-Security settings
+type HSTS struct {
+	MaxAge            int  `json:"max_age"`
+	IncludeSubDomains bool `json:"include_subdomains,omitempty"`
+	Preload           bool `json:"preload,omitempty"`
+}
+
+// Response model of the non redirect actions
+type Response struct {
+	Action      string `json:"action,omitempty"`
+	Status      int    `json:"status,omitempty"`
+	Body        string `json:"body,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Proxy       *Proxy `json:"proxy,omitempty"`
+}
+
+// ResponseHeaders model of the headers added to the responses of a domain or a path rule
+type ResponseHeaders struct {
+	CacheControl string            `json:"cache_control,omitempty"`
+	MaxAge       *int              `json:"max_age,omitempty"`
+	RobotsTag    string            `json:"robots_tag,omitempty"`
+	Canonical    string            `json:"canonical,omitempty"`
+	Headers      map[string]string `json:"headers,omitempty"`
+}
+
+// PathNormalization model of the normalization applied to the path rules and requests of a domain
+type PathNormalization struct {
+	CaseInsensitive    bool `json:"case_insensitive,omitempty"`
+	StripTrailingSlash bool `json:"strip_trailing_slash,omitempty"`
+	Decode             bool `json:"decode,omitempty"`
+	CollapseSlashes    bool `json:"collapse_slashes,omitempty"`
+}
+
 // PathMappingEntry model
 type PathMappingEntry struct {
-	From string `json:"from"`
-	To   string `json:"to"`
+	From            string            `json:"from"`
+	To              string            `json:"to"`
+	Regex           bool              `json:"regex,omitempty"`
+	Exact           bool              `json:"exact,omitempty"`
+	Targets         []WeightedTarget  `json:"targets,omitempty"`
+	ValidFrom       string            `json:"valid_from,omitempty"`
+	ValidUntil      string            `json:"valid_until,omitempty"`
+	Code            int               `json:"code,omitempty"`
+	Query           []QueryCondition  `json:"query,omitempty"`
+	Headers         []HeaderCondition `json:"headers,omitempty"`
+	Cookies         []CookieCondition `json:"cookies,omitempty"`
+	Languages       []string          `json:"languages,omitempty"`
+	UserAgent       string            `json:"user_agent,omitempty"`
+	Device          string            `json:"device,omitempty"`
+	Countries       []string          `json:"countries,omitempty"`
+	Continents      []string          `json:"continents,omitempty"`
+	QueryPolicy     *QueryPolicy      `json:"query_policy,omitempty"`
+	ResponseHeaders *ResponseHeaders  `json:"response_headers,omitempty"`
+	Response
+	position int
 }
 
 // PathList model
@@ -56,23 +160,98 @@ type TLSCacheEntry struct {
 
 // Domain struct as it is received via the request body entry
 type Domain struct {
-	ID           string    `json:"id"`
-	Name         string    `json:"domain"`
-	PathMapping  *PathList `json:"paths"`
-	Redirect     string    `json:"redirect"`
-	Promotable   bool      `json:"promotable"`
-	Wildcard     bool      `json:"wildcard"`
-	Certificate  string    `json:"certificate"`
-	RedirectCode int       `json:"code"`
-	Description  string    `json:"description"`
-	Created      string    `json:"created"`
-	Modified     string    `json:"modified"`
+	ID                string             `json:"id"`
+	Name              string             `json:"domain"`
+	DisplayName       string             `json:"display_name,omitempty" dynamodbav:"-"`
+	Aliases           []string           `json:"aliases,omitempty"`
+	PathMapping       *PathList          `json:"paths"`
+	Redirect          string             `json:"redirect"`
+	Promotable        bool               `json:"promotable"`
+	Wildcard          bool               `json:"wildcard"`
+	Certificate       string             `json:"certificate"`
+	RedirectCode      int                `json:"code"`
+	Description       string             `json:"description"`
+	QueryPolicy       *QueryPolicy       `json:"query_policy,omitempty"`
+	Targets           []WeightedTarget   `json:"targets,omitempty"`
+	ValidFrom         string             `json:"valid_from,omitempty"`
+	ValidUntil        string             `json:"valid_until,omitempty"`
+	NotFound          *Response          `json:"not_found,omitempty"`
+	ForceHTTPS        bool               `json:"force_https,omitempty"`
+	HSTS              *HSTS              `json:"hsts,omitempty"`
+	PathNormalization *PathNormalization `json:"path_normalization,omitempty"`
+	ResponseHeaders   *ResponseHeaders   `json:"response_headers,omitempty"`
+	Created           string             `json:"created"`
+	Modified          string             `json:"modified"`
+	Response
+	index *pathIndex
+}
+
+// Decision is the calculated response for a request
+type Decision struct {
+	Action      string
+	Location    string
+	Code        int
+	Body        string
+	ContentType string
+	Proxy       *Proxy
+	Rule        *PathMappingEntry
+	Split       string
+	Variant     string
+	Cookie      *http.Cookie
+	Headers     http.Header
+}
+
+// Chain of redirects starting at a managed url
+type Chain struct {
+	Start   string   `json:"start"`
+	Hops    []string `json:"hops"`
+	Flatten string   `json:"flatten"`
+	Loop    bool     `json:"loop"`
+}
+
+// ChainReport lists the loops and the chains longer than one hop
+type ChainReport struct {
+	Loops  []Chain `json:"loops"`
+	Chains []Chain `json:"chains"`
+}
+
+// VerifyCase model of an url and its expected redirect
+type VerifyCase struct {
+	URL          string `json:"url"`
+	Expected     string `json:"expected"`
+	ExpectedCode int    `json:"expected_code,omitempty"`
+}
+
+// VerifyResult model of the evaluated case
+type VerifyResult struct {
+	VerifyCase
+	Location string `json:"location"`
+	Code     int    `json:"code"`
+	Pass     bool   `json:"pass"`
+	Error    string `json:"error,omitempty"`
+}
+
+// VerifyReport model of the verification
+type VerifyReport struct {
+	Total    int            `json:"total"`
+	Passed   int            `json:"passed"`
+	Failed   int            `json:"failed"`
+	Failures []VerifyResult `json:"failures"`
 }
 
 // DomainDB entry
 type DomainDB struct {
 	Domain
 	BinPathMapping *[]byte `json:"bin_paths"`
+	PathChunks     []int   `json:"path_chunks,omitempty"`
+	PathChunkKeys  []int   `json:"path_chunk_keys,omitempty"`
+}
+
+// PathChunk entry of the paths table holding a part of the path rules of a domain
+type PathChunk struct {
+	Domain string `json:"domain"`
+	Chunk  int    `json:"chunk"`
+	Paths  []byte `json:"paths"`
 }
 
 // ExportDomains model
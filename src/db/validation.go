@@ -0,0 +1,142 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	// ValidationRequired marks a missing value
+	ValidationRequired = "required"
+	// ValidationInvalid marks a malformed or unsupported value
+	ValidationInvalid = "invalid"
+	// ValidationDuplicate marks a value used more than once
+	ValidationDuplicate = "duplicate"
+	// ValidationPublicSuffix marks a name registrable by anyone like co.uk
+	ValidationPublicSuffix = "public_suffix"
+	// ValidationLoop marks redirects leading back to an already visited url
+	ValidationLoop = "loop"
+)
+
+// ValidationError model of a rejected field of the domain
+type ValidationError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors list of the rejected fields of the domain
+type ValidationErrors []ValidationError
+
+// Error returns the message
+func (e ValidationError) Error() string {
+	return e.Message
+}
+
+// add appends a validation error
+func (e *ValidationErrors) add(field string, code string, format string, args ...interface{}) {
+	*e = append(*e, ValidationError{
+		Field:   field,
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// Messages returns the messages of the validation errors
+func (e ValidationErrors) Messages() []string {
+	res := []string{}
+	for _, err := range e {
+		res = append(res, err.Message)
+	}
+	return res
+}
+
+// Error joins the messages
+func (e ValidationErrors) Error() string {
+	return strings.Join(e.Messages(), ". ")
+}
+
+// ValidateDraft validates an unsaved domain. The id and dates of the stored record aren't required
+func (d *Domain) ValidateDraft() ValidationErrors {
+	res := ValidationErrors{}
+	for _, err := range d.Validate() {
+		if err.Field != "id" && err.Field != "created" {
+			res = append(res, err)
+		}
+	}
+	return res
+}
+
+// pathField returns the name of a field of the path rule at the index
+func pathField(index int, field string) string {
+	if field == "" {
+		return fmt.Sprintf("paths[%d]", index)
+	}
+	return fmt.Sprintf("paths[%d].%s", index, field)
+}
+
+// validTarget checks the redirect target being an absolute http or https url. Relative targets
+// have to be an absolute path. Template variables are replaced by sample values before
+func validTarget(target string, relative bool) bool {
+	sample := templatePattern.ReplaceAllStringFunc(target, func(v string) string {
+		switch v {
+		case "{scheme}":
+			return "https"
+		case "{path}":
+			return "/path"
+		case "{query}":
+			return "query"
+		}
+		return "sample"
+	})
+
+	if strings.ContainsAny(sample, " \t\r\n") {
+		return false
+	}
+
+	if relative && strings.HasPrefix(sample, "/") && !strings.HasPrefix(sample, "//") {
+		_, err := url.Parse(sample)
+		return err == nil
+	}
+
+	u, err := url.Parse(sample)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// duplicatePaths returns the positions of path rules matching the same requests as an earlier
+// rule. Conditional and scheduled rules may share their from path
+func (d *Domain) duplicatePaths() []int {
+	res := []int{}
+	if d.PathMapping == nil {
+		return res
+	}
+
+	seen := map[string]bool{}
+	for i, p := range *d.PathMapping {
+		if p.From == "" || p.hasConditions() || p.ValidFrom != "" || p.ValidUntil != "" {
+			continue
+		}
+		key := p.Type() + " " + p.From
+		if seen[key] {
+			res = append(res, i)
+		}
+		seen[key] = true
+	}
+
+	return res
+}
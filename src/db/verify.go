@@ -0,0 +1,121 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"crypto/tls"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// ReadVerifyCSV reads the url, the expected location and an optional expected code per line.
+// A leading header line is skipped
+func ReadVerifyCSV(r io.Reader) ([]VerifyCase, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	res := []VerifyCase{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if line == 1 && !isAbsoluteURL(record[0]) {
+			continue
+		}
+		if len(record) < 2 || len(record) > 3 || record[0] == "" {
+			return nil, fmt.Errorf("Invalid line %d", line)
+		}
+
+		c := VerifyCase{URL: record[0], Expected: record[1]}
+		if len(record) == 3 && record[2] != "" {
+			if c.ExpectedCode, err = strconv.Atoi(record[2]); err != nil {
+				return nil, fmt.Errorf("Invalid code on line %d", line)
+			}
+		}
+		res = append(res, c)
+	}
+}
+
+// urlRequest returns a GET request of the url like the listener of its scheme receives it
+func urlRequest(target *url.URL) *http.Request {
+	req := &http.Request{
+		Method: http.MethodGet,
+		URL:    target,
+		Host:   target.Host,
+		Header: http.Header{},
+	}
+	if target.Scheme == "https" {
+		req.TLS = &tls.ConnectionState{}
+	}
+	return req
+}
+
+// verify evaluates a single case
+func (c VerifyCase) verify(lookup Lookup) VerifyResult {
+	res := VerifyResult{VerifyCase: c}
+
+	target, err := url.Parse(c.URL)
+	if err != nil || target.Host == "" {
+		res.Error = "Invalid url"
+		return res
+	}
+
+	host, err := NormalizeHost(target.Host)
+	if err != nil {
+		res.Error = "Invalid url"
+		return res
+	}
+
+	domain, found := lookup(host)
+	if !found {
+		res.Error = "Unknown host"
+		return res
+	}
+
+	res.Location, res.Code = domain.GetRedirect(urlRequest(target))
+	res.Pass = chainKey(res.Location) == chainKey(c.Expected) && (c.ExpectedCode == 0 || c.ExpectedCode == res.Code)
+
+	return res
+}
+
+// Verify evaluates the cases against the domains of the lookup. The report lists the failed cases
+func Verify(cases []VerifyCase, lookup Lookup) VerifyReport {
+	report := VerifyReport{
+		Total:    len(cases),
+		Failures: []VerifyResult{},
+	}
+
+	for _, c := range cases {
+		res := c.verify(lookup)
+		if res.Pass {
+			report.Passed++
+			continue
+		}
+		report.Failed++
+		report.Failures = append(report.Failures, res)
+	}
+
+	return report
+}
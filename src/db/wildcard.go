@@ -0,0 +1,65 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+const (
+	// WildcardPrefix marks the name of a wildcard domain
+	WildcardPrefix = "*."
+)
+
+// validWildcard checks the wildcard flag against the domain name. A wildcard
+// has to be a single leading label and must not cover a public suffix like *.co.uk
+func (d *Domain) validWildcard() bool {
+	if !d.Wildcard {
+		return !strings.Contains(d.Name, "*")
+	}
+
+	if !strings.HasPrefix(d.Name, WildcardPrefix) {
+		return false
+	}
+
+	base := strings.TrimPrefix(d.Name, WildcardPrefix)
+	if base == "" || strings.Contains(base, "*") {
+		return false
+	}
+
+	suffix, _ := publicsuffix.PublicSuffix(base)
+	return suffix != base
+}
+
+// WildcardNames returns the wildcard domain names covering the host, the most specific first
+func WildcardNames(host string) []string {
+	res := []string{}
+	labels := strings.Split(host, ".")
+
+	for i := 1; i < len(labels); i++ {
+		res = append(res, WildcardPrefix+strings.Join(labels[i:], "."))
+	}
+
+	return res
+}
+
+// isPublicSuffix checks for names under which anyone can register like co.uk or github.io.
+// Single label names without a managed suffix like localhost are not public suffixes
+func isPublicSuffix(name string) bool {
+	suffix, icann := publicsuffix.PublicSuffix(name)
+	return suffix == name && (icann || strings.Contains(name, "."))
+}
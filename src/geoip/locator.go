@@ -0,0 +1,103 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package geoip
+
+import (
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/axelspringer/swerve/src/log"
+	geoip2 "github.com/oschwald/geoip2-golang"
+)
+
+const (
+	pollTickerInterval = 1
+)
+
+// NewLocator opens the MaxMind database file
+func NewLocator(path string) (*Locator, error) {
+	l := &Locator{
+		Path:       path,
+		PollTicker: time.NewTicker(time.Minute * pollTickerInterval),
+		mutex:      &sync.RWMutex{},
+	}
+
+	if err := l.reload(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// reload opens the database file when it was modified since the last load
+func (l *Locator) reload() error {
+	info, err := os.Stat(l.Path)
+	if err != nil {
+		return err
+	}
+
+	if !info.ModTime().After(l.modTime) {
+		return nil
+	}
+
+	reader, err := geoip2.Open(l.Path)
+	if err != nil {
+		return err
+	}
+
+	l.mutex.Lock()
+	old := l.reader
+	l.reader = reader
+	l.modTime = info.ModTime()
+	l.mutex.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+
+	log.Infof("GeoIP database %s loaded", l.Path)
+
+	return nil
+}
+
+// Observe the database file and reload it on changes
+func (l *Locator) Observe() {
+	go func() {
+		for range l.PollTicker.C {
+			if err := l.reload(); err != nil {
+				log.Errorf("Error while reloading the GeoIP database %v", err)
+			}
+		}
+	}()
+}
+
+// Lookup returns the ISO country code and the continent code of the ip address
+func (l *Locator) Lookup(ip net.IP) (string, string) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	if l.reader == nil || ip == nil {
+		return "", ""
+	}
+
+	record, err := l.reader.Country(ip)
+	if err != nil {
+		return "", ""
+	}
+
+	return record.Country.IsoCode, record.Continent.Code
+}
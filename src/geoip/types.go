@@ -0,0 +1,31 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package geoip
+
+import (
+	"sync"
+	"time"
+
+	geoip2 "github.com/oschwald/geoip2-golang"
+)
+
+// Locator resolves client ip addresses with an offline MaxMind database
+type Locator struct {
+	Path       string
+	PollTicker *time.Ticker
+	reader     *geoip2.Reader
+	modTime    time.Time
+	mutex      *sync.RWMutex
+}
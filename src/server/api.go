@@ -22,6 +22,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/axelspringer/swerve/src/certificate"
 	"github.com/axelspringer/swerve/src/configuration"
 	jwt "github.com/dgrijalva/jwt-go"
 
@@ -61,10 +62,11 @@ func prometheusHandler() httprouter.Handle {
 }
 
 // NewAPIServer creates a new API server instance
-func NewAPIServer(listener string, apiSecret string, dynDB *db.DynamoDB) *API {
+func NewAPIServer(listener string, apiSecret string, dynDB *db.DynamoDB, certManager *certificate.Manager) *API {
 	api := &API{
-		listener: listener,
-		db:       dynDB,
+		listener:    listener,
+		db:          dynDB,
+		certManager: certManager,
 	}
 
 	secret = apiSecret
@@ -85,6 +87,13 @@ func NewAPIServer(listener string, apiSecret string, dynDB *db.DynamoDB) *API {
 	authRouter.POST("/api/domain", api.registerDomain)
 	authRouter.DELETE("/api/domain/:name", api.purgeDomain)
 	authRouter.PUT("/api/domain/:name", api.updateDomain)
+	authRouter.GET("/api/domain/:name/paths", api.fetchPaths)
+	authRouter.POST("/api/domain/:name/paths", api.addPath)
+	authRouter.PUT("/api/domain/:name/paths/:index", api.updatePath)
+	authRouter.DELETE("/api/domain/:name/paths/:index", api.deletePath)
+	authRouter.POST("/api/resolve", api.resolve)
+	authRouter.POST("/api/verify", api.verify)
+	authRouter.GET("/api/domain/:name/debug", api.debugToken)
 	authRouter.GET("/refresh", api.refresh)
 
 	router.NotFound = AuthHandler(authRouter)
@@ -111,6 +120,112 @@ func (api *API) options(w http.ResponseWriter, r *http.Request, _ httprouter.Par
 	w.WriteHeader(http.StatusOK)
 }
 
+// lookup resolves hosts through the domain cache with the draft domain taking precedence over its cached version
+func (api *API) lookup(draft *db.Domain) db.Lookup {
+	return func(host string) (*db.Domain, bool) {
+		for _, name := range draft.Names() {
+			if host == name {
+				return draft, true
+			}
+		}
+
+		if domain, err := api.certManager.GetDomain(host); err == nil && domain.Name != draft.Name {
+			return domain, true
+		}
+
+		if draft.Wildcard {
+			for _, name := range db.WildcardNames(host) {
+				if name == draft.Name {
+					return draft, true
+				}
+			}
+		}
+
+		return nil, false
+	}
+}
+
+// checkDomain validates the domain, checks its names against the other domains and rejects
+// redirect loops. It responds with the error and returns false for rejected domains
+func (api *API) checkDomain(w http.ResponseWriter, domain *db.Domain) (db.ChainReport, bool) {
+	// validate
+	if errList := domain.Validate(); len(errList) > 0 {
+		sendValidationErrors(w, errList)
+		return db.ChainReport{}, false
+	}
+
+	// names and aliases are unique across the domains. The aliases are also looked up in the
+	// domains table to catch domains added since the last domain cache update
+	domains := api.certManager.CertCache.Domains()
+	for _, alias := range domain.Aliases {
+		exists, err := api.db.DomainExists(alias)
+		if err != nil {
+			log.Error(err)
+			sendJSONMessage(w, "Could not check database for already used names", http.StatusInternalServerError)
+			return db.ChainReport{}, false
+		}
+		if exists {
+			domains = append(domains, db.Domain{Name: alias})
+		}
+	}
+
+	if conflicts := domain.Conflicts(domains); len(conflicts) > 0 {
+		errList := db.ValidationErrors{}
+		for _, name := range conflicts {
+			field := "aliases"
+			if name == domain.Name {
+				field = "domain"
+			}
+			errList = append(errList, db.ValidationError{Field: field, Code: db.ValidationDuplicate, Message: "Already used " + name})
+		}
+		sendValidationErrors(w, errList)
+		return db.ChainReport{}, false
+	}
+
+	// reject redirect loops through the managed domains
+	report := domain.CheckChains(api.lookup(domain))
+	if len(report.Loops) > 0 {
+		errList := db.ValidationErrors{}
+		for _, loop := range report.Loops {
+			errList = append(errList, db.ValidationError{Field: "paths", Code: db.ValidationLoop, Message: "Redirect loop " + loop.String()})
+		}
+		sendValidationErrors(w, errList)
+		return report, false
+	}
+
+	return report, true
+}
+
+// domainName returns the stored key of the domain name route parameter. It is the canonical
+// form of the name unless the domain was stored with the given name before the host normalization
+func (api *API) domainName(ps httprouter.Params) string {
+	name := ps.ByName("name")
+	canonical, err := db.NormalizeHost(name)
+	if err != nil || canonical == name {
+		return name
+	}
+
+	if exists, err := api.db.DomainExists(canonical); err != nil || exists {
+		return canonical
+	}
+	if exists, err := api.db.DomainExists(name); err == nil && exists {
+		return name
+	}
+
+	return canonical
+}
+
+// renameDomain stores a domain kept under a key from before the host normalization with its
+// canonical name and removes the former entry
+func (api *API) renameDomain(domain db.Domain, key string) error {
+	if err := api.db.InsertDomain(domain); err != nil {
+		return err
+	}
+
+	_, err := api.db.DeleteByDomain(key)
+	return err
+}
+
 // health handler
 func (api *API) health(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	sendJSONMessage(w, "ok", http.StatusOK)
@@ -170,7 +285,7 @@ func (api *API) importDomains(w http.ResponseWriter, r *http.Request, _ httprout
 
 // purgeDomain deletes a domain entry
 func (api *API) purgeDomain(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	name := ps.ByName("name")
+	name := api.domainName(ps)
 	domain, err := api.db.FetchByDomain(name)
 	if domain == nil || err != nil {
 		sendJSONMessage(w, "Not found", http.StatusNotFound)
@@ -183,7 +298,9 @@ func (api *API) purgeDomain(w http.ResponseWriter, r *http.Request, ps httproute
 		return
 	}
 
-	api.db.DeleteTLSCacheEntry(name)
+	for _, name := range domain.Names() {
+		api.db.DeleteTLSCacheEntry(name)
+	}
 
 	sendJSONMessage(w, "ok", http.StatusNoContent)
 }
@@ -195,7 +312,7 @@ func (api *API) updateDomain(w http.ResponseWriter, r *http.Request, ps httprout
 		return
 	}
 
-	name := ps.ByName("name")
+	name := api.domainName(ps)
 	oldDomain, err := api.db.FetchByDomain(name)
 
 	if oldDomain == nil || err != nil {
@@ -212,20 +329,20 @@ func (api *API) updateDomain(w http.ResponseWriter, r *http.Request, ps httprout
 
 	domain.ID = oldDomain.ID
 	domain.Created = oldDomain.Created
-	domain.Modified = time.Now().Format(time.RFC3339)
+	domain.Modified = db.ModifiedAt(time.Now())
 
-	// validate
-	if errList := domain.Validate(); len(errList) > 0 {
-		errMsg := ""
-		for _, err := range errList {
-			errMsg = errMsg + err.Error() + ". "
-		}
-		sendJSONMessage(w, errMsg, http.StatusBadRequest)
+	report, ok := api.checkDomain(w, &domain)
+	if !ok {
 		return
 	}
 
-	// insert new domain
-	if err := api.db.InsertDomain(domain); err != nil {
+	// insert new domain, entries stored before the host normalization move to their canonical name
+	if canonical, _ := db.NormalizeHost(name); name != domain.Name && canonical == domain.Name {
+		err = api.renameDomain(domain, name)
+	} else {
+		err = api.db.InsertDomain(domain)
+	}
+	if err != nil {
 		log.Error(err)
 		sendJSONMessage(w, "Can't store document", http.StatusInternalServerError)
 		return
@@ -233,7 +350,7 @@ func (api *API) updateDomain(w http.ResponseWriter, r *http.Request, ps httprout
 
 	// api.db.DeleteTLSCacheEntry(id)
 
-	sendJSONMessage(w, "ok", http.StatusOK)
+	sendStored(w, report, nil, http.StatusOK)
 }
 
 // fetchAllDomains return a list of all domains
@@ -263,7 +380,7 @@ func (api *API) fetchAllDomains(w http.ResponseWriter, r *http.Request, _ httpro
 }
 
 func (api *API) fetchDomain(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	name := ps.ByName("name")
+	name := api.domainName(ps)
 	domain, err := api.db.FetchByDomain(name)
 	if err != nil {
 		sendJSONMessage(w, "Not found", http.StatusNotFound)
@@ -286,6 +403,10 @@ func (api *API) registerDomain(w http.ResponseWriter, r *http.Request, _ httprou
 		return
 	}
 
+	if name, err := db.NormalizeHost(domain.Name); err == nil {
+		domain.Name = name
+	}
+
 	alreadyExisting, err := api.db.FetchByDomain(domain.Name)
 	if err != nil {
 		sendJSONMessage(w, "Could not check database for already existing entry", http.StatusInternalServerError)
@@ -298,15 +419,10 @@ func (api *API) registerDomain(w http.ResponseWriter, r *http.Request, _ httprou
 
 	domain.ID = uuid.Must(uuid.NewV4()).String()
 	domain.Created = time.Now().Format(time.RFC3339)
-	domain.Modified = domain.Created
+	domain.Modified = db.ModifiedAt(time.Now())
 
-	// validate
-	if errList := domain.Validate(); len(errList) > 0 {
-		errMsg := ""
-		for _, err := range errList {
-			errMsg = errMsg + err.Error() + ". "
-		}
-		sendJSONMessage(w, errMsg, http.StatusBadRequest)
+	report, ok := api.checkDomain(w, &domain)
+	if !ok {
 		return
 	}
 
@@ -317,7 +433,7 @@ func (api *API) registerDomain(w http.ResponseWriter, r *http.Request, _ httprou
 		return
 	}
 
-	sendJSONMessage(w, "ok", http.StatusCreated)
+	sendStored(w, report, nil, http.StatusCreated)
 }
 
 func (api *API) login(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -0,0 +1,156 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/axelspringer/swerve/src/certificate"
+	"github.com/axelspringer/swerve/src/db"
+	"github.com/axelspringer/swerve/src/db/dbtest"
+	"github.com/julienschmidt/httprouter"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("API", func() {
+	It("Check domain rejects a name used as alias by a cached domain", func() {
+		manager := certificate.NewManager(nil, false)
+		manager.CertCache.SetDomains([]db.Domain{
+			{Name: "example.com", Aliases: []string{"shop.example.com"}},
+		})
+		api := NewAPIServer(":0", "secret", nil, manager)
+
+		domain := &db.Domain{
+			ID:           "1",
+			Name:         "shop.example.com",
+			Redirect:     "https://www.example.org/",
+			RedirectCode: 301,
+			Created:      "2019-01-01T00:00:00Z",
+			Modified:     "2019-01-01T00:00:00Z",
+		}
+		w := httptest.NewRecorder()
+		_, ok := api.checkDomain(w, domain)
+		Expect(ok).To(BeFalse())
+		Expect(w.Code).To(Equal(http.StatusBadRequest))
+
+		var res struct {
+			Errors db.ValidationErrors `json:"errors"`
+		}
+		Expect(json.NewDecoder(w.Body).Decode(&res)).To(BeNil())
+		Expect(res.Errors).To(Equal(db.ValidationErrors{
+			{Field: "domain", Code: db.ValidationDuplicate, Message: "Already used shop.example.com"},
+		}))
+	})
+
+	It("Check domain rejects a redirect loop with a validation error", func() {
+		manager := certificate.NewManager(nil, false)
+		manager.CertCache.SetDomains([]db.Domain{
+			{Name: "b.example.com", Redirect: "https://a.example.com/", RedirectCode: 301},
+		})
+		api := NewAPIServer(":0", "secret", nil, manager)
+
+		domain := &db.Domain{
+			ID:           "1",
+			Name:         "a.example.com",
+			Redirect:     "https://b.example.com/",
+			RedirectCode: 301,
+			Created:      "2019-01-01T00:00:00Z",
+			Modified:     "2019-01-01T00:00:00Z",
+		}
+		w := httptest.NewRecorder()
+		_, ok := api.checkDomain(w, domain)
+		Expect(ok).To(BeFalse())
+		Expect(w.Code).To(Equal(http.StatusBadRequest))
+
+		var res struct {
+			Errors db.ValidationErrors `json:"errors"`
+		}
+		Expect(json.NewDecoder(w.Body).Decode(&res)).To(BeNil())
+		Expect(res.Errors).To(Equal(db.ValidationErrors{{
+			Field:   "paths",
+			Code:    db.ValidationLoop,
+			Message: "Redirect loop https://a.example.com/ -> https://b.example.com/ -> https://a.example.com/",
+		}}))
+	})
+
+	It("Stored changes report chains instead of the result", func() {
+		w := httptest.NewRecorder()
+		sendStored(w, db.ChainReport{}, nil, http.StatusCreated)
+		Expect(w.Code).To(Equal(http.StatusCreated))
+		Expect(w.Body.String()).To(Equal(`{"code":201,"message":"ok"}`))
+
+		w = httptest.NewRecorder()
+		sendStored(w, db.ChainReport{}, PathEntry{Index: 1}, http.StatusOK)
+		var entry struct {
+			Data PathEntry `json:"data"`
+		}
+		Expect(json.NewDecoder(w.Body).Decode(&entry)).To(BeNil())
+		Expect(entry.Data.Index).To(Equal(1))
+
+		chain := db.Chain{Start: "https://a.example.com/", Hops: []string{"https://b.example.com/", "https://c.example.com/"}}
+		w = httptest.NewRecorder()
+		sendStored(w, db.ChainReport{Chains: []db.Chain{chain}}, PathEntry{Index: 1}, http.StatusOK)
+		var report struct {
+			Data db.ChainReport `json:"data"`
+		}
+		Expect(json.NewDecoder(w.Body).Decode(&report)).To(BeNil())
+		Expect(report.Data.Chains).To(Equal([]db.Chain{chain}))
+	})
+
+	It("Domains stored before the host normalization stay reachable", func() {
+		database := &db.DynamoDB{Service: dbtest.NewFakeDynamo()}
+		legacy := db.Domain{
+			ID:           "1",
+			Name:         "Example.com",
+			Redirect:     "https://www.example.org/",
+			RedirectCode: 301,
+			Created:      "2019-01-01T00:00:00Z",
+			Modified:     "2019-01-01T00:00:00Z",
+		}
+		Expect(database.InsertDomain(legacy)).To(BeNil())
+		manager := certificate.NewManager(nil, false)
+		manager.CertCache.SetDomains([]db.Domain{legacy})
+		api := NewAPIServer(":0", "secret", database, manager)
+		ps := httprouter.Params{{Key: "name", Value: "Example.com"}}
+
+		w := httptest.NewRecorder()
+		api.fetchDomain(w, httptest.NewRequest(http.MethodGet, "/api/domain/Example.com", nil), ps)
+		Expect(w.Code).To(Equal(http.StatusOK))
+		var res struct {
+			Data db.Domain `json:"data"`
+		}
+		Expect(json.NewDecoder(w.Body).Decode(&res)).To(BeNil())
+		Expect(res.Data.ID).To(Equal("1"))
+
+		// an update moves the entry to its canonical name
+		body := `{"domain": "Example.com", "redirect": "https://www.example.net/", "code": 301}`
+		w = httptest.NewRecorder()
+		api.updateDomain(w, httptest.NewRequest(http.MethodPut, "/api/domain/Example.com", strings.NewReader(body)), ps)
+		Expect(w.Code).To(Equal(http.StatusOK))
+
+		exists, err := database.DomainExists("Example.com")
+		Expect(err).To(BeNil())
+		Expect(exists).To(BeFalse())
+		domain, err := database.FetchByDomain("example.com")
+		Expect(err).To(BeNil())
+		Expect(domain.ID).To(Equal("1"))
+		Expect(domain.Redirect).To(Equal("https://www.example.net/"))
+	})
+})
@@ -0,0 +1,137 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/axelspringer/swerve/src/db"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// DebugHeader carries the debug token of a request
+	DebugHeader = "X-Swerve-Debug"
+	// debugQuery is the query parameter alternative to the debug header
+	debugQuery = "swerve-debug"
+	// debugTokenTTL is the maximum lifetime of a debug token
+	debugTokenTTL = 24 * time.Hour
+)
+
+// DebugSecret signs the debug tokens. Debug responses are disabled without a secret
+var DebugSecret string
+
+// debugSignature signs the domain name and the expiry
+func debugSignature(name string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(DebugSecret))
+	mac.Write([]byte(fmt.Sprintf("%s|%d", name, expires)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// DebugToken creates a token enabling the debug headers for the domain until the expiry
+func DebugToken(name string, expires time.Time) string {
+	return fmt.Sprintf("%d.%s", expires.Unix(), debugSignature(name, expires.Unix()))
+}
+
+// validDebugToken tests the token against the domain name and the current time
+func validDebugToken(token string, name string, now time.Time) bool {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return false
+	}
+
+	expires, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || now.Unix() > expires {
+		return false
+	}
+
+	return hmac.Equal([]byte(parts[1]), []byte(debugSignature(name, expires)))
+}
+
+// stripDebugQuery removes the debug token from the query keeping the order of the other parameters
+func stripDebugQuery(r *http.Request) {
+	params := []string{}
+	for _, param := range strings.Split(r.URL.RawQuery, "&") {
+		if param != "" && param != debugQuery && !strings.HasPrefix(param, debugQuery+"=") {
+			params = append(params, param)
+		}
+	}
+	r.URL.RawQuery = strings.Join(params, "&")
+}
+
+// isDebugRequest tests the request for a valid debug token of the domain. A token sent
+// as query parameter is removed from the request before it is resolved
+func isDebugRequest(r *http.Request, domain *db.Domain) bool {
+	if DebugSecret == "" {
+		return false
+	}
+
+	token := r.Header.Get(DebugHeader)
+	if query := r.URL.Query().Get(debugQuery); query != "" {
+		token = query
+		stripDebugQuery(r)
+	}
+
+	return token != "" && validDebugToken(token, domain.Name, time.Now())
+}
+
+// setDebugHeaders describes the domain entry and its age in the domain cache
+func setDebugHeaders(w http.ResponseWriter, domain *db.Domain, cacheAge time.Duration) {
+	w.Header().Set("X-Swerve-Domain", domain.Name)
+	w.Header().Set("X-Swerve-Cache-Age", strconv.Itoa(int(cacheAge.Seconds())))
+}
+
+// debugRule describes the matched rule by its position, type and from path
+func debugRule(domain *db.Domain, rule *db.PathMappingEntry) string {
+	if rule == nil {
+		return "default"
+	}
+	return fmt.Sprintf("%d %s %s", domain.RuleIndex(rule), rule.Type(), rule.From)
+}
+
+// debugToken creates a debug token for the domain
+func (api *API) debugToken(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if DebugSecret == "" {
+		sendJSONMessage(w, "Debug mode is disabled", http.StatusNotFound)
+		return
+	}
+
+	ttl, ok := queryInt(r, "ttl", int(time.Hour.Seconds()))
+	if !ok || ttl == 0 || time.Duration(ttl)*time.Second > debugTokenTTL {
+		sendJSONMessage(w, "Invalid ttl", http.StatusBadRequest)
+		return
+	}
+
+	domain, err := api.db.FetchByDomain(api.domainName(ps))
+	if domain == nil || err != nil || domain.ID == "" {
+		sendJSONMessage(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	expires := time.Now().Add(time.Duration(ttl) * time.Second)
+	sendJSON(w, DebugTokenResponse{
+		Header:  DebugHeader,
+		Query:   debugQuery,
+		Token:   DebugToken(domain.Name, expires),
+		Expires: expires.UTC().Format(time.RFC3339),
+	}, http.StatusOK)
+}
@@ -0,0 +1,117 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/axelspringer/swerve/src/certificate"
+	"github.com/axelspringer/swerve/src/db"
+	"github.com/axelspringer/swerve/src/db/dbtest"
+	"github.com/julienschmidt/httprouter"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Debug", func() {
+	var secret string
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	BeforeEach(func() {
+		secret = DebugSecret
+		DebugSecret = "debug-secret"
+	})
+
+	AfterEach(func() {
+		DebugSecret = secret
+	})
+
+	It("Debug token is valid for the domain until it expires", func() {
+		token := DebugToken("example.com", now.Add(time.Hour))
+		Expect(validDebugToken(token, "example.com", now)).To(BeTrue())
+		Expect(validDebugToken(token, "example.com", now.Add(time.Hour))).To(BeTrue())
+		Expect(validDebugToken(token, "example.com", now.Add(time.Hour+time.Second))).To(BeFalse())
+		Expect(validDebugToken(token, "www.example.com", now)).To(BeFalse())
+	})
+
+	It("Debug token is rejected when tampered", func() {
+		token := DebugToken("example.com", now.Add(time.Hour))
+		parts := strings.SplitN(token, ".", 2)
+
+		// a later expiry doesn't match the signature
+		later := DebugToken("example.com", now.Add(48*time.Hour))
+		Expect(validDebugToken(strings.SplitN(later, ".", 2)[0]+"."+parts[1], "example.com", now)).To(BeFalse())
+
+		// a changed signature
+		signature := []byte(parts[1])
+		if signature[0] == 'a' {
+			signature[0] = 'b'
+		} else {
+			signature[0] = 'a'
+		}
+		Expect(validDebugToken(parts[0]+"."+string(signature), "example.com", now)).To(BeFalse())
+
+		Expect(validDebugToken(parts[0], "example.com", now)).To(BeFalse())
+		Expect(validDebugToken("x."+parts[1], "example.com", now)).To(BeFalse())
+		Expect(validDebugToken("", "example.com", now)).To(BeFalse())
+	})
+
+	It("Debug token is rejected when signed with another secret", func() {
+		token := DebugToken("example.com", now.Add(time.Hour))
+		DebugSecret = "other-secret"
+		Expect(validDebugToken(token, "example.com", now)).To(BeFalse())
+	})
+
+	It("Debug token in the query is removed from the request", func() {
+		domain := &db.Domain{Name: "example.com"}
+		token := DebugToken("example.com", time.Now().Add(time.Hour))
+
+		r := httptest.NewRequest(http.MethodGet, "https://example.com/a?b=1&swerve-debug="+token+"&c=2", nil)
+		Expect(isDebugRequest(r, domain)).To(BeTrue())
+		Expect(r.URL.RawQuery).To(Equal("b=1&c=2"))
+
+		r = httptest.NewRequest(http.MethodGet, "https://example.com/a", nil)
+		r.Header.Set(DebugHeader, token)
+		Expect(isDebugRequest(r, domain)).To(BeTrue())
+
+		DebugSecret = ""
+		Expect(isDebugRequest(r, domain)).To(BeFalse())
+	})
+
+	It("Debug token is only created for stored domains", func() {
+		database := &db.DynamoDB{Service: dbtest.NewFakeDynamo()}
+		Expect(database.InsertDomain(db.Domain{ID: "1", Name: "example.com", Redirect: "https://www.example.com/"})).To(BeNil())
+		api := NewAPIServer(":0", "secret", database, certificate.NewManager(nil, false))
+
+		w := httptest.NewRecorder()
+		api.debugToken(w, httptest.NewRequest(http.MethodGet, "/api/domain/unknown.com/debug", nil), httprouter.Params{{Key: "name", Value: "unknown.com"}})
+		Expect(w.Code).To(Equal(http.StatusNotFound))
+
+		w = httptest.NewRecorder()
+		api.debugToken(w, httptest.NewRequest(http.MethodGet, "/api/domain/example.com/debug", nil), httprouter.Params{{Key: "name", Value: "example.com"}})
+		Expect(w.Code).To(Equal(http.StatusOK))
+
+		var res struct {
+			Data DebugTokenResponse `json:"data"`
+		}
+		Expect(json.NewDecoder(w.Body).Decode(&res)).To(BeNil())
+		Expect(validDebugToken(res.Data.Token, "example.com", time.Now())).To(BeTrue())
+	})
+})
@@ -0,0 +1,94 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/axelspringer/swerve/src/log"
+)
+
+const (
+	// FallbackNotFound responds with a plain 404, the default
+	FallbackNotFound = "notfound"
+	// FallbackRedirect redirects to the fallback target
+	FallbackRedirect = "redirect"
+	// FallbackPage responds with the html page of the fallback target file and 404
+	FallbackPage = "page"
+	// FallbackClose closes the connection without a response
+	FallbackClose = "close"
+)
+
+// NewFallback creates the response for unknown hosts
+func NewFallback(mode string, target string) (*Fallback, error) {
+	fallback := &Fallback{
+		Mode:   mode,
+		Target: target,
+	}
+
+	switch mode {
+	case "", FallbackNotFound, FallbackClose:
+	case FallbackRedirect:
+		targetURL, err := url.Parse(target)
+		if err != nil || targetURL.Host == "" {
+			return nil, errors.New("Invalid fallback redirect target")
+		}
+	case FallbackPage:
+		page, err := ioutil.ReadFile(target)
+		if err != nil {
+			return nil, err
+		}
+		fallback.page = page
+	default:
+		return nil, errors.New("Invalid fallback mode")
+	}
+
+	return fallback, nil
+}
+
+// serve responds to a request of an unknown host and returns the status code
+func (f *Fallback) serve(w http.ResponseWriter, r *http.Request) int {
+	if f == nil {
+		http.NotFound(w, r)
+		return http.StatusNotFound
+	}
+
+	switch f.Mode {
+	case FallbackRedirect:
+		http.Redirect(w, r, f.Target, http.StatusFound)
+		return http.StatusFound
+	case FallbackPage:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(f.page)
+		return http.StatusNotFound
+	case FallbackClose:
+		if hijacker, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hijacker.Hijack(); err == nil {
+				conn.Close()
+				return 0
+			}
+		}
+		log.Info("Connection can't be hijacked, aborting the request")
+		// aborts http/2 streams without a response
+		panic(http.ErrAbortHandler)
+	}
+
+	http.NotFound(w, r)
+	return http.StatusNotFound
+}
@@ -0,0 +1,103 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Fallback", func() {
+	It("Fallback rejects unknown modes and invalid targets", func() {
+		_, err := NewFallback("unknown", "")
+		Expect(err).To(MatchError("Invalid fallback mode"))
+
+		_, err = NewFallback(FallbackRedirect, "/relative")
+		Expect(err).To(MatchError("Invalid fallback redirect target"))
+
+		_, err = NewFallback(FallbackPage, "/does/not/exist.html")
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("Fallback without mode answers 404", func() {
+		fallback, err := NewFallback("", "")
+		Expect(err).To(BeNil())
+
+		w := httptest.NewRecorder()
+		Expect(fallback.serve(w, httptest.NewRequest(http.MethodGet, "http://unknown.example.com/", nil))).To(Equal(http.StatusNotFound))
+		Expect(w.Code).To(Equal(http.StatusNotFound))
+
+		w = httptest.NewRecorder()
+		Expect((*Fallback)(nil).serve(w, httptest.NewRequest(http.MethodGet, "http://unknown.example.com/", nil))).To(Equal(http.StatusNotFound))
+		Expect(w.Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("Fallback redirects to the target", func() {
+		fallback, err := NewFallback(FallbackRedirect, "https://www.example.com/")
+		Expect(err).To(BeNil())
+
+		w := httptest.NewRecorder()
+		Expect(fallback.serve(w, httptest.NewRequest(http.MethodGet, "http://unknown.example.com/a", nil))).To(Equal(http.StatusFound))
+		Expect(w.Code).To(Equal(http.StatusFound))
+		Expect(w.Header().Get("Location")).To(Equal("https://www.example.com/"))
+	})
+
+	It("Fallback responds with the page and 404", func() {
+		file, err := ioutil.TempFile("", "fallback")
+		Expect(err).To(BeNil())
+		defer os.Remove(file.Name())
+		_, err = file.WriteString("<html>unknown</html>")
+		Expect(err).To(BeNil())
+		Expect(file.Close()).To(BeNil())
+
+		fallback, err := NewFallback(FallbackPage, file.Name())
+		Expect(err).To(BeNil())
+
+		w := httptest.NewRecorder()
+		Expect(fallback.serve(w, httptest.NewRequest(http.MethodGet, "http://unknown.example.com/", nil))).To(Equal(http.StatusNotFound))
+		Expect(w.Code).To(Equal(http.StatusNotFound))
+		Expect(w.Header().Get("Content-Type")).To(Equal("text/html; charset=utf-8"))
+		Expect(w.Body.String()).To(Equal("<html>unknown</html>"))
+	})
+
+	It("Fallback closes the connection without a response", func() {
+		fallback, err := NewFallback(FallbackClose, "")
+		Expect(err).To(BeNil())
+
+		codes := make(chan int, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			codes <- fallback.serve(w, r)
+		}))
+		defer server.Close()
+
+		_, err = http.Get(server.URL)
+		Expect(err).NotTo(BeNil())
+		Expect(<-codes).To(Equal(0))
+	})
+
+	It("Fallback aborts the request if the connection can't be hijacked", func() {
+		fallback, err := NewFallback(FallbackClose, "")
+		Expect(err).To(BeNil())
+
+		Expect(func() {
+			fallback.serve(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://unknown.example.com/", nil))
+		}).To(PanicWith(http.ErrAbortHandler))
+	})
+})
@@ -17,9 +17,11 @@ package server
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"time"
 
+	"github.com/axelspringer/swerve/src/db"
 	"github.com/axelspringer/swerve/src/log"
 )
 
@@ -44,6 +46,40 @@ func sendJSONMessage(w http.ResponseWriter, msg string, code int) {
 	w.Write([]byte(fmt.Sprintf("{\"code\":%d,\"message\":\"%s\"}", code, msg)))
 }
 
+// sendValidationErrors responds with the rejected fields of the domain or the request body
+func sendValidationErrors(w http.ResponseWriter, errList db.ValidationErrors) {
+	jsonBytes, _ := json.Marshal(struct {
+		Code    int                 `json:"code"`
+		Message string              `json:"message"`
+		Errors  db.ValidationErrors `json:"errors"`
+	}{
+		Code:    http.StatusBadRequest,
+		Message: errList.Error(),
+		Errors:  errList,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", uiDomain)
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write(jsonBytes)
+}
+
+// sendStored responds to a stored change with the result. Chains longer than one hop are stored
+// but reported with a flatten suggestion instead. Without a result the response is a plain ok
+func sendStored(w http.ResponseWriter, report db.ChainReport, res interface{}, code int) {
+	if len(report.Chains) > 0 {
+		sendJSON(w, report, code)
+		return
+	}
+
+	if res == nil {
+		sendJSONMessage(w, "ok", code)
+		return
+	}
+
+	sendJSON(w, res, code)
+}
+
 func sendPlainMessage(w http.ResponseWriter, msg string, code int) {
 	w.Header().Set("Content-Type", "text/plain")
 	w.Header().Set("Access-Control-Allow-Origin", uiDomain)
@@ -52,6 +88,51 @@ func sendPlainMessage(w http.ResponseWriter, msg string, code int) {
 	w.Write([]byte(fmt.Sprintf("%d - %s", code, msg)))
 }
 
+// sendUpgrade redirects the request to https on the same host
+func sendUpgrade(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(r.Host); err == nil {
+		host = h
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+}
+
+// sendDecision writes the response decided by the domain and returns the status code
+func sendDecision(w http.ResponseWriter, r *http.Request, domain *db.Domain, debug bool) int {
+	decision := domain.Resolve(r)
+
+	if debug {
+		w.Header().Set("X-Swerve-Rule", debugRule(domain, decision.Rule))
+	}
+
+	if decision.Cookie != nil {
+		http.SetCookie(w, decision.Cookie)
+		splitCounter.WithLabelValues(domain.Name, decision.Split, decision.Variant).Inc()
+	}
+
+	// the upstream headers of proxied requests are overridden in the proxy
+	if decision.Action != db.ActionProxy {
+		for name, values := range decision.Headers {
+			w.Header()[name] = values
+		}
+	}
+
+	switch decision.Action {
+	case db.ActionProxy:
+		return sendProxy(w, r, decision)
+	case db.ActionStatus:
+		http.Error(w, http.StatusText(decision.Code), decision.Code)
+	case db.ActionStatic:
+		w.Header().Set("Content-Type", decision.ContentType)
+		w.WriteHeader(decision.Code)
+		w.Write([]byte(decision.Body))
+	default:
+		http.Redirect(w, r, decision.Location, decision.Code)
+	}
+
+	return decision.Code
+}
+
 func handlerWithLogging(f func(http.ResponseWriter, *http.Request)) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -33,16 +33,33 @@ func (h *HTTP) handleRedirect(w http.ResponseWriter, r *http.Request) {
 	domain, err := h.certManager.GetDomain(hostHeader)
 	msg := "Response with status code %d"
 
+	debug := domain != nil && err == nil && isDebugRequest(r, domain)
+	if debug {
+		setDebugHeaders(w, domain, h.certManager.CertCache.CacheAge())
+	}
+
+	// upgrade to https on the same host first
+	if domain != nil && err == nil && domain.ForceHTTPS {
+		if debug {
+			w.Header().Set("X-Swerve-Rule", "upgrade")
+		}
+		for name, values := range domain.ResponseHeader(nil) {
+			w.Header()[name] = values
+		}
+		sendUpgrade(w, r)
+		log.Infof(msg, http.StatusMovedPermanently)
+		return
+	}
+
 	// regular domain lookup
 	if domain != nil && err == nil {
-		redirectURL, redirectCode := domain.GetRedirect(r.URL)
-		http.Redirect(w, r, redirectURL, redirectCode)
+		redirectCode := sendDecision(w, r, domain, debug)
 		log.Infof(msg, redirectCode)
 		return
 	}
 
-	log.Infof(msg, http.StatusNotFound)
-	http.NotFound(w, r)
+	// unknown host
+	log.Infof(msg, h.fallback.serve(w, r))
 }
 
 // Handler for requests
@@ -53,10 +70,11 @@ func (h *HTTP) handler() http.Handler {
 }
 
 // NewHTTPServer creates a new instance
-func NewHTTPServer(listener string, certManager *certificate.Manager) *HTTP {
+func NewHTTPServer(listener string, certManager *certificate.Manager, fallback *Fallback) *HTTP {
 	server := &HTTP{
 		listener:    listener,
 		certManager: certManager,
+		fallback:    fallback,
 	}
 
 	server.server = &http.Server{
@@ -37,21 +37,28 @@ func (h *HTTPS) redirectHandler() http.Handler {
 
 		// regular domain lookup
 		if domain != nil && err == nil {
-			redirectURL, redirectCode := domain.GetRedirect(r.URL)
-			http.Redirect(w, r, redirectURL, redirectCode)
+			if domain.HSTS != nil {
+				w.Header().Set("Strict-Transport-Security", domain.HSTS.Header())
+			}
+			debug := isDebugRequest(r, domain)
+			if debug {
+				setDebugHeaders(w, domain, h.certManager.CertCache.CacheAge())
+			}
+			redirectCode := sendDecision(w, r, domain, debug)
 			log.Infof(msg, redirectCode)
 			return
 		}
 
-		log.Infof(msg, http.StatusNotFound)
-		http.NotFound(w, r)
+		// unknown host
+		log.Infof(msg, h.fallback.serve(w, r))
 	})
 }
 
 // NewHTTPSServer creates a new instance
-func NewHTTPSServer(listener string, certManager *certificate.Manager) *HTTPS {
+func NewHTTPSServer(listener string, certManager *certificate.Manager, fallback *Fallback) *HTTPS {
 	server := &HTTPS{
 		certManager: certManager,
+		fallback:    fallback,
 		listener:    listener,
 	}
 
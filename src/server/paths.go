@@ -0,0 +1,324 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/axelspringer/swerve/src/db"
+	"github.com/axelspringer/swerve/src/log"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	defaultPathPageSize = 100
+	maxPathPageSize     = 1000
+	maxPathUploadSize   = 32 << 20
+)
+
+// queryInt reads a non negative integer query parameter
+func queryInt(r *http.Request, name string, fallback int) (int, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, true
+	}
+
+	res, err := strconv.Atoi(value)
+	if err != nil || res < 0 {
+		return 0, false
+	}
+
+	return res, true
+}
+
+// fetchPaths returns a page of the path rules of a domain
+func (api *API) fetchPaths(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	offset, ok := queryInt(r, "offset", 0)
+	if !ok {
+		sendJSONMessage(w, "Invalid offset", http.StatusBadRequest)
+		return
+	}
+
+	limit, ok := queryInt(r, "limit", defaultPathPageSize)
+	if !ok || limit == 0 || limit > maxPathPageSize {
+		sendJSONMessage(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	paths, total, err := api.db.FetchPaths(api.domainName(ps), offset, limit)
+	if err == db.ErrDomainNotFound {
+		sendJSONMessage(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error(err)
+		sendJSONMessage(w, "Error while fetching paths", http.StatusInternalServerError)
+		return
+	}
+
+	entries := []PathEntry{}
+	for i, p := range paths {
+		entries = append(entries, PathEntry{Index: offset + i, PathMappingEntry: p})
+	}
+
+	sendJSON(w, struct {
+		Paths  []PathEntry `json:"paths"`
+		Offset int         `json:"offset"`
+		Total  int         `json:"total"`
+	}{
+		entries,
+		offset,
+		total,
+	}, http.StatusOK)
+}
+
+// updatePath replaces a single path rule of a domain
+func (api *API) updatePath(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if r.Body == nil {
+		sendJSONMessage(w, "Please send a request body", http.StatusBadRequest)
+		return
+	}
+
+	domain, ok := api.fetchPathDomain(w, ps)
+	if !ok {
+		return
+	}
+
+	index, err := strconv.Atoi(ps.ByName("index"))
+	if err != nil || index < 0 || index >= len(*domain.PathMapping) {
+		sendJSONMessage(w, "Path not found", http.StatusNotFound)
+		return
+	}
+
+	var entry db.PathMappingEntry
+	if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+		sendJSONMessage(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	(*domain.PathMapping)[index] = entry
+
+	api.storePaths(w, domain, index, http.StatusOK, PathEntry{Index: index, PathMappingEntry: entry}, api.db.UpdatePath)
+}
+
+// fetchPathDomain loads the domain of the path rule endpoints and responds with 404 for unknown domains
+func (api *API) fetchPathDomain(w http.ResponseWriter, ps httprouter.Params) (*db.Domain, bool) {
+	domain, err := api.db.FetchByDomain(api.domainName(ps))
+	if domain == nil || err != nil || domain.ID == "" {
+		sendJSONMessage(w, "Not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	if domain.PathMapping == nil {
+		domain.PathMapping = &db.PathList{}
+	}
+
+	return domain, true
+}
+
+// storePaths validates the domain and stores the path rules changed from the index on with the
+// update. Changes of a domain modified since it was read are rejected with 409
+func (api *API) storePaths(w http.ResponseWriter, domain *db.Domain, first int, code int, res interface{},
+	update func(db.Domain, int, string) error) {
+	key := domain.Name
+	modified := domain.Modified
+	domain.Modified = db.ModifiedAt(time.Now())
+
+	report, ok := api.checkDomain(w, domain)
+	if !ok {
+		return
+	}
+
+	// entries stored before the host normalization move to their canonical name
+	if key != domain.Name {
+		update = func(d db.Domain, _ int, _ string) error {
+			return api.renameDomain(d, key)
+		}
+	}
+
+	err := update(*domain, first, modified)
+	if err == db.ErrConflict {
+		sendJSONMessage(w, "Domain was modified concurrently", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Error(err)
+		sendJSONMessage(w, "Can't store document", http.StatusInternalServerError)
+		return
+	}
+
+	sendStored(w, report, res, code)
+}
+
+// addPath adds a path rule to a domain. CSV request bodies are imported as bulk upload
+func (api *API) addPath(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if r.Body == nil {
+		sendJSONMessage(w, "Please send a request body", http.StatusBadRequest)
+		return
+	}
+
+	if contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); contentType == "text/csv" {
+		api.uploadPaths(w, r, ps)
+		return
+	}
+
+	var entry db.PathMappingEntry
+	if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+		sendJSONMessage(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	domain, ok := api.fetchPathDomain(w, ps)
+	if !ok {
+		return
+	}
+
+	// the rule is appended without an index
+	paths := *domain.PathMapping
+	index, ok := queryInt(r, "index", len(paths))
+	if !ok || index > len(paths) {
+		sendJSONMessage(w, "Invalid index", http.StatusBadRequest)
+		return
+	}
+
+	paths = append(paths, db.PathMappingEntry{})
+	copy(paths[index+1:], paths[index:])
+	paths[index] = entry
+	domain.PathMapping = &paths
+
+	api.storePaths(w, domain, index, http.StatusCreated, PathEntry{Index: index, PathMappingEntry: entry}, api.db.UpdatePaths)
+}
+
+// deletePath removes a single path rule of a domain
+func (api *API) deletePath(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	domain, ok := api.fetchPathDomain(w, ps)
+	if !ok {
+		return
+	}
+
+	paths := *domain.PathMapping
+	index, err := strconv.Atoi(ps.ByName("index"))
+	if err != nil || index < 0 || index >= len(paths) {
+		sendJSONMessage(w, "Path not found", http.StatusNotFound)
+		return
+	}
+
+	paths = append(paths[:index], paths[index+1:]...)
+	domain.PathMapping = &paths
+
+	api.storePaths(w, domain, index, http.StatusOK, struct {
+		Total int `json:"total"`
+	}{
+		len(paths),
+	}, api.db.UpdatePaths)
+}
+
+// readPathCSV reads from,to and an optional code per line. A leading header line is skipped
+func readPathCSV(r io.Reader) (db.PathList, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	res := db.PathList{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if line == 1 && strings.EqualFold(record[0], "from") {
+			continue
+		}
+		if len(record) < 2 || len(record) > 3 || record[0] == "" || record[1] == "" {
+			return nil, fmt.Errorf("Invalid line %d", line)
+		}
+
+		entry := db.PathMappingEntry{From: record[0], To: record[1]}
+		if len(record) == 3 && record[2] != "" {
+			if entry.Code, err = strconv.Atoi(record[2]); err != nil {
+				return nil, fmt.Errorf("Invalid code on line %d", line)
+			}
+		}
+		res = append(res, entry)
+	}
+}
+
+// uploadPaths imports a CSV of from,to pairs. Plain rules with the same from are updated, the
+// other lines are appended
+func (api *API) uploadPaths(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	entries, err := readPathCSV(http.MaxBytesReader(w, r.Body, maxPathUploadSize))
+	if err != nil {
+		sendValidationErrors(w, db.ValidationErrors{{Field: "csv", Code: db.ValidationInvalid, Message: err.Error()}})
+		return
+	}
+
+	domain, ok := api.fetchPathDomain(w, ps)
+	if !ok {
+		return
+	}
+
+	// the stored rules are normalized
+	for i := range entries {
+		domain.NormalizeRule(&entries[i])
+	}
+
+	paths := *domain.PathMapping
+	plain := map[string]int{}
+	for i, p := range paths {
+		if p.IsPlain() {
+			plain[p.From] = i
+		}
+	}
+
+	first := len(paths)
+	added, updated := 0, 0
+	for _, entry := range entries {
+		i, ok := plain[entry.From]
+		if !ok {
+			plain[entry.From] = len(paths)
+			paths = append(paths, entry)
+			added++
+			continue
+		}
+		paths[i].To = entry.To
+		paths[i].Code = entry.Code
+		if i < first {
+			first = i
+		}
+		updated++
+	}
+	domain.PathMapping = &paths
+
+	api.storePaths(w, domain, first, http.StatusOK, struct {
+		Added   int `json:"added"`
+		Updated int `json:"updated"`
+		Total   int `json:"total"`
+	}{
+		added,
+		updated,
+		len(paths),
+	}, api.db.UpdatePaths)
+}
@@ -0,0 +1,85 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/axelspringer/swerve/src/certificate"
+	"github.com/axelspringer/swerve/src/db"
+	"github.com/axelspringer/swerve/src/db/dbtest"
+	"github.com/julienschmidt/httprouter"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Paths", func() {
+	It("Upload rejects an invalid csv line with a json error", func() {
+		api := NewAPIServer(":0", "secret", nil, certificate.NewManager(nil, false))
+
+		r := httptest.NewRequest(http.MethodPost, "/api/domain/example.com/paths", strings.NewReader("from,to\n/a\n"))
+		r.Header.Set("Content-Type", "text/csv")
+		w := httptest.NewRecorder()
+		api.addPath(w, r, nil)
+		Expect(w.Code).To(Equal(http.StatusBadRequest))
+
+		var res struct {
+			Errors db.ValidationErrors `json:"errors"`
+		}
+		Expect(json.NewDecoder(w.Body).Decode(&res)).To(BeNil())
+		Expect(res.Errors).To(HaveLen(1))
+		Expect(res.Errors[0].Field).To(Equal("csv"))
+		Expect(res.Errors[0].Message).To(Equal("Invalid line 2"))
+	})
+
+	It("Upload updates the stored rules of a case insensitive domain", func() {
+		database := &db.DynamoDB{Service: dbtest.NewFakeDynamo()}
+		Expect(database.InsertDomain(db.Domain{
+			ID:                "1",
+			Name:              "example.com",
+			Redirect:          "https://www.example.com/",
+			RedirectCode:      301,
+			Created:           "2019-01-01T00:00:00Z",
+			Modified:          "2019-01-01T00:00:00Z",
+			PathNormalization: &db.PathNormalization{CaseInsensitive: true, StripTrailingSlash: true},
+			PathMapping:       &db.PathList{{From: "/foo", To: "/old"}},
+		})).To(BeNil())
+		api := NewAPIServer(":0", "secret", database, certificate.NewManager(nil, false))
+
+		r := httptest.NewRequest(http.MethodPost, "/api/domain/example.com/paths", strings.NewReader("/Foo,/new\n/Bar/,/bar\n"))
+		r.Header.Set("Content-Type", "text/csv")
+		w := httptest.NewRecorder()
+		api.addPath(w, r, httprouter.Params{{Key: "name", Value: "example.com"}})
+		Expect(w.Code).To(Equal(http.StatusOK))
+
+		var res struct {
+			Data struct {
+				Added   int `json:"added"`
+				Updated int `json:"updated"`
+			} `json:"data"`
+		}
+		Expect(json.NewDecoder(w.Body).Decode(&res)).To(BeNil())
+		Expect(res.Data.Added).To(Equal(1))
+		Expect(res.Data.Updated).To(Equal(1))
+
+		domain, err := database.FetchByDomain("example.com")
+		Expect(err).To(BeNil())
+		Expect(*domain.PathMapping).To(Equal(db.PathList{{From: "/foo", To: "/new"}, {From: "/bar/", To: "/bar"}}))
+	})
+})
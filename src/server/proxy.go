@@ -0,0 +1,146 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/axelspringer/swerve/src/db"
+	"github.com/axelspringer/swerve/src/log"
+)
+
+// DefaultProxyTimeout is the upstream response timeout of proxies without their own timeout
+const DefaultProxyTimeout = 30 * time.Second
+
+var (
+	proxyTransports = map[time.Duration]*http.Transport{}
+	proxyMutex      = &sync.Mutex{}
+)
+
+// statusWriter keeps the status code written by the reverse proxy
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+// WriteHeader stores the status code
+func (s *statusWriter) WriteHeader(code int) {
+	s.code = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// Flush supports streamed upstream responses
+func (s *statusWriter) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// proxyTransport returns the shared transport of the timeout so the upstream connections are reused
+func proxyTransport(timeout time.Duration) *http.Transport {
+	proxyMutex.Lock()
+	defer proxyMutex.Unlock()
+
+	if transport, ok := proxyTransports[timeout]; ok {
+		return transport
+	}
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   timeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: timeout,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	proxyTransports[timeout] = transport
+
+	return transport
+}
+
+// sendProxy forwards the request to the upstream location of the decision and returns the status code
+func sendProxy(w http.ResponseWriter, r *http.Request, decision *db.Decision) int {
+	target, err := url.Parse(decision.Location)
+	if err != nil {
+		log.Errorf("Invalid proxy location %s. %v", decision.Location, err)
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return http.StatusBadGateway
+	}
+
+	timeout := DefaultProxyTimeout
+	if decision.Proxy.Timeout > 0 {
+		timeout = time.Duration(decision.Proxy.Timeout) * time.Second
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = target.Scheme
+			req.URL.Host = target.Host
+			req.URL.Path = target.Path
+			req.URL.RawPath = target.RawPath
+			req.URL.RawQuery = target.RawQuery
+
+			switch {
+			case decision.Proxy.Host != "":
+				req.Host = decision.Proxy.Host
+			case !decision.Proxy.PreserveHost:
+				req.Host = target.Host
+			}
+
+			req.Header.Set("X-Forwarded-Host", r.Host)
+			req.Header.Set("X-Forwarded-Proto", scheme)
+			if _, ok := req.Header["User-Agent"]; !ok {
+				// keep the go default user agent out of the upstream logs
+				req.Header.Set("User-Agent", "")
+			}
+		},
+		Transport:     proxyTransport(timeout),
+		FlushInterval: 100 * time.Millisecond,
+		ModifyResponse: func(resp *http.Response) error {
+			for name, values := range decision.Headers {
+				resp.Header[name] = values
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			log.Errorf("Error while proxying %s to %s. %v", r.Host, target.Host, err)
+			code := http.StatusBadGateway
+			if netErr, ok := err.(net.Error); (ok && netErr.Timeout()) || err == context.DeadlineExceeded {
+				code = http.StatusGatewayTimeout
+			}
+			w.WriteHeader(code)
+		},
+	}
+
+	writer := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+	proxy.ServeHTTP(writer, r)
+
+	return writer.code
+}
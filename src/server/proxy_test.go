@@ -0,0 +1,152 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/axelspringer/swerve/src/db"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// proxyUpstream returns an upstream server recording the last request
+func proxyUpstream(handler http.HandlerFunc) (*httptest.Server, **http.Request) {
+	var last *http.Request
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		last = r
+		handler(w, r)
+	}))
+	return upstream, &last
+}
+
+var _ = Describe("Proxy", func() {
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+	}
+
+	It("Proxy rewrites the host to the upstream and sets the forwarded headers", func() {
+		upstream, last := proxyUpstream(ok)
+		defer upstream.Close()
+
+		r := httptest.NewRequest(http.MethodGet, "http://www.example.com/a?b=1", nil)
+		w := httptest.NewRecorder()
+		code := sendProxy(w, r, &db.Decision{
+			Action:   db.ActionProxy,
+			Location: upstream.URL + "/upstream/a?b=1",
+			Proxy:    &db.Proxy{Upstream: upstream.URL},
+		})
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(w.Code).To(Equal(http.StatusOK))
+
+		Expect((*last).Host).To(Equal(upstream.Listener.Addr().String()))
+		Expect((*last).URL.Path).To(Equal("/upstream/a"))
+		Expect((*last).URL.RawQuery).To(Equal("b=1"))
+		Expect((*last).Header.Get("X-Forwarded-Host")).To(Equal("www.example.com"))
+		Expect((*last).Header.Get("X-Forwarded-Proto")).To(Equal("http"))
+	})
+
+	It("Proxy keeps the request host with preserve_host", func() {
+		upstream, last := proxyUpstream(ok)
+		defer upstream.Close()
+
+		r := httptest.NewRequest(http.MethodGet, "http://www.example.com/a", nil)
+		sendProxy(httptest.NewRecorder(), r, &db.Decision{
+			Action:   db.ActionProxy,
+			Location: upstream.URL + "/a",
+			Proxy:    &db.Proxy{Upstream: upstream.URL, PreserveHost: true},
+		})
+		Expect((*last).Host).To(Equal("www.example.com"))
+
+		sendProxy(httptest.NewRecorder(), r, &db.Decision{
+			Action:   db.ActionProxy,
+			Location: upstream.URL + "/a",
+			Proxy:    &db.Proxy{Upstream: upstream.URL, Host: "backend.example.com", PreserveHost: true},
+		})
+		Expect((*last).Host).To(Equal("backend.example.com"))
+	})
+
+	It("Proxy sends the https scheme of tls requests upstream", func() {
+		upstream, last := proxyUpstream(ok)
+		defer upstream.Close()
+
+		r := httptest.NewRequest(http.MethodGet, "https://www.example.com/a", nil)
+		sendProxy(httptest.NewRecorder(), r, &db.Decision{
+			Action:   db.ActionProxy,
+			Location: upstream.URL + "/a",
+			Proxy:    &db.Proxy{Upstream: upstream.URL},
+		})
+		Expect((*last).Header.Get("X-Forwarded-Proto")).To(Equal("https"))
+	})
+
+	It("Proxy overrides the upstream response headers with the headers of the decision", func() {
+		upstream, _ := proxyUpstream(ok)
+		defer upstream.Close()
+
+		r := httptest.NewRequest(http.MethodGet, "http://www.example.com/a", nil)
+		w := httptest.NewRecorder()
+		sendProxy(w, r, &db.Decision{
+			Action:   db.ActionProxy,
+			Location: upstream.URL + "/a",
+			Proxy:    &db.Proxy{Upstream: upstream.URL},
+			Headers: http.Header{
+				"Cache-Control":   {"max-age=60"},
+				"X-Frame-Options": {"DENY"},
+			},
+		})
+		Expect(w.Header()["Cache-Control"]).To(Equal([]string{"max-age=60"}))
+		Expect(w.Header().Get("X-Frame-Options")).To(Equal("DENY"))
+	})
+
+	It("Proxy answers 504 on upstream timeout", func() {
+		release := make(chan struct{})
+		upstream, _ := proxyUpstream(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-release:
+			case <-time.After(5 * time.Second):
+			}
+		})
+		defer upstream.Close()
+		defer close(release)
+
+		r := httptest.NewRequest(http.MethodGet, "http://www.example.com/a", nil)
+		w := httptest.NewRecorder()
+		code := sendProxy(w, r, &db.Decision{
+			Action:   db.ActionProxy,
+			Location: upstream.URL + "/a",
+			Proxy:    &db.Proxy{Upstream: upstream.URL, Timeout: 1},
+		})
+		Expect(code).To(Equal(http.StatusGatewayTimeout))
+		Expect(w.Code).To(Equal(http.StatusGatewayTimeout))
+	})
+
+	It("Proxy answers 502 for unreachable upstreams", func() {
+		upstream, _ := proxyUpstream(ok)
+		upstream.Close()
+
+		r := httptest.NewRequest(http.MethodGet, "http://www.example.com/a", nil)
+		w := httptest.NewRecorder()
+		code := sendProxy(w, r, &db.Decision{
+			Action:   db.ActionProxy,
+			Location: upstream.URL + "/a",
+			Proxy:    &db.Proxy{Upstream: upstream.URL},
+		})
+		Expect(code).To(Equal(http.StatusBadGateway))
+	})
+})
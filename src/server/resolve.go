@@ -0,0 +1,140 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/axelspringer/swerve/src/db"
+	"github.com/julienschmidt/httprouter"
+)
+
+// resolveDomain finds the domain of the host. A draft covering the host wins over the domain cache
+func (api *API) resolveDomain(host string, draft *db.Domain) (*db.Domain, string) {
+	if draft != nil {
+		if domain, found := api.lookup(draft)(host); found {
+			if domain == draft {
+				return draft.Sorted(), ResolveDraft
+			}
+			return domain, ResolveCache
+		}
+		return nil, ""
+	}
+
+	if domain, err := api.certManager.GetDomain(host); err == nil {
+		return domain, ResolveCache
+	}
+
+	return nil, ""
+}
+
+// resolve explains the response of the listeners for a request against the domain cache or a draft domain
+func (api *API) resolve(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if r.Body == nil {
+		sendJSONMessage(w, "Please send a request body", http.StatusBadRequest)
+		return
+	}
+
+	var query ResolveRequest
+	if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+		sendJSONMessage(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	target, err := url.Parse(query.URL)
+	if err != nil || target.Host == "" || (target.Scheme != "http" && target.Scheme != "https") {
+		sendJSONMessage(w, "Invalid url", http.StatusBadRequest)
+		return
+	}
+
+	host, err := db.NormalizeHost(target.Host)
+	if err != nil {
+		sendJSONMessage(w, "Invalid url", http.StatusBadRequest)
+		return
+	}
+
+	if query.Domain != nil {
+		if errList := query.Domain.ValidateDraft(); len(errList) > 0 {
+			sendValidationErrors(w, errList)
+			return
+		}
+	}
+
+	method := query.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequest(method, target.String(), nil)
+	if err != nil {
+		sendJSONMessage(w, "Invalid method", http.StatusBadRequest)
+		return
+	}
+	for name, value := range query.Headers {
+		req.Header.Set(name, value)
+	}
+	req.RemoteAddr = query.RemoteAddr
+	// the https listener serves the request over tls
+	if target.Scheme == "https" {
+		req.TLS = &tls.ConnectionState{}
+	}
+
+	domain, source := api.resolveDomain(host, query.Domain)
+	if domain == nil {
+		sendJSONMessage(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	res := Resolution{
+		Domain: domain.Name,
+		Source: source,
+	}
+
+	// the http listener upgrades to https first
+	if target.Scheme == "http" && domain.ForceHTTPS {
+		res.Action = db.ActionRedirect
+		res.Location = "https://" + target.Hostname() + target.RequestURI()
+		res.Status = http.StatusMovedPermanently
+		res.Upgrade = true
+		res.Headers = domain.ResponseHeader(nil)
+		sendJSON(w, res, http.StatusOK)
+		return
+	}
+
+	if target.Scheme == "https" && domain.HSTS != nil {
+		res.HSTS = domain.HSTS.Header()
+	}
+
+	decision := domain.Resolve(req)
+	res.Action = decision.Action
+	if res.Action == "" {
+		res.Action = db.ActionRedirect
+	}
+	res.Location = decision.Location
+	res.Status = decision.Code
+	res.Variant = decision.Variant
+	res.Headers = decision.Headers
+	if decision.Rule != nil {
+		res.Rule = &ResolvedRule{
+			Index: domain.RuleIndex(decision.Rule),
+			Type:  decision.Rule.Type(),
+			From:  decision.Rule.From,
+		}
+	}
+
+	sendJSON(w, res, http.StatusOK)
+}
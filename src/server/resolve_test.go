@@ -0,0 +1,57 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/axelspringer/swerve/src/certificate"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Resolve", func() {
+	It("Resolve a draft domain without id", func() {
+		api := NewAPIServer(":0", "secret", nil, certificate.NewManager(nil, false))
+
+		body := `{
+			"url": "https://draft.example.com/a",
+			"domain": {
+				"domain": "draft.example.com",
+				"redirect": "https://www.example.com/",
+				"code": 301,
+				"hsts": {"max_age": 300},
+				"paths": [{"from": "/a", "to": "{scheme}://www.example.com/a"}]
+			}
+		}`
+		w := httptest.NewRecorder()
+		api.resolve(w, httptest.NewRequest(http.MethodPost, "/api/resolve", strings.NewReader(body)), nil)
+		Expect(w.Code).To(Equal(http.StatusOK))
+
+		var res struct {
+			Data Resolution `json:"data"`
+		}
+		Expect(json.NewDecoder(w.Body).Decode(&res)).To(BeNil())
+		Expect(res.Data.Source).To(Equal(ResolveDraft))
+		Expect(res.Data.Location).To(Equal("https://www.example.com/a"))
+		Expect(res.Data.Status).To(Equal(http.StatusMovedPermanently))
+		Expect(res.Data.HSTS).To(Equal("max-age=300"))
+		Expect(res.Data.Rule.From).To(Equal("/a"))
+	})
+})
@@ -34,15 +34,81 @@ type ListenerInterface interface {
 // API server model
 type API struct {
 	ListenerInterface
-	db       *db.DynamoDB
-	server   *http.Server
-	listener string
+	db          *db.DynamoDB
+	certManager *certificate.Manager
+	server      *http.Server
+	listener    string
+}
+
+// Fallback model of the response for unknown hosts
+type Fallback struct {
+	Mode   string
+	Target string
+	page   []byte
+}
+
+// PathEntry model of a path rule and its position in the path mapping
+type PathEntry struct {
+	Index int `json:"index"`
+	db.PathMappingEntry
+}
+
+const (
+	// ResolveCache marks resolutions against the domain cache
+	ResolveCache = "cache"
+	// ResolveDraft marks resolutions against the draft domain of the request
+	ResolveDraft = "draft"
+)
+
+// ResolveRequest model of the resolve endpoint
+type ResolveRequest struct {
+	URL        string            `json:"url"`
+	Method     string            `json:"method,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	RemoteAddr string            `json:"remote_addr,omitempty"`
+	Domain     *db.Domain        `json:"domain,omitempty"`
+}
+
+// VerifyRequest model of the verify endpoint
+type VerifyRequest struct {
+	Cases  []db.VerifyCase `json:"cases"`
+	Domain *db.Domain      `json:"domain,omitempty"`
+}
+
+// DebugTokenResponse model of a created debug token
+type DebugTokenResponse struct {
+	Header  string `json:"header"`
+	Query   string `json:"query"`
+	Token   string `json:"token"`
+	Expires string `json:"expires"`
+}
+
+// ResolvedRule model of the matched path rule
+type ResolvedRule struct {
+	Index int    `json:"index"`
+	Type  string `json:"type"`
+	From  string `json:"from"`
+}
+
+// Resolution model of the resolve endpoint response
+type Resolution struct {
+	Domain   string        `json:"domain"`
+	Source   string        `json:"source"`
+	Rule     *ResolvedRule `json:"rule"`
+	Action   string        `json:"action"`
+	Location string        `json:"location,omitempty"`
+	Status   int           `json:"status"`
+	Variant  string        `json:"variant,omitempty"`
+	Upgrade  bool          `json:"upgrade,omitempty"`
+	Headers  http.Header   `json:"headers,omitempty"`
+	HSTS     string        `json:"hsts,omitempty"`
 }
 
 // HTTP server model
 type HTTP struct {
 	ListenerInterface
 	certManager *certificate.Manager
+	fallback    *Fallback
 	server      *http.Server
 	listener    string
 }
@@ -51,6 +117,7 @@ type HTTP struct {
 type HTTPS struct {
 	ListenerInterface
 	certManager *certificate.Manager
+	fallback    *Fallback
 	server      *http.Server
 	listener    string
 }
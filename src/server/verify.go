@@ -0,0 +1,79 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+
+	"github.com/axelspringer/swerve/src/db"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	maxVerifyUploadSize = 32 << 20
+)
+
+// verifyLookup resolves hosts through the domain cache or with a draft domain taking precedence
+func (api *API) verifyLookup(draft *db.Domain) db.Lookup {
+	if draft == nil {
+		return api.certManager.CertCache.IsDomainAcceptable
+	}
+
+	sorted := draft.Sorted()
+	sorted.Compile()
+	lookup := api.lookup(draft)
+	return func(host string) (*db.Domain, bool) {
+		domain, found := lookup(host)
+		if found && domain == draft {
+			return sorted, true
+		}
+		return domain, found
+	}
+}
+
+// verify evaluates a list of urls and their expected redirects. The cases are sent
+// as csv file or as json with an optional draft domain
+func (api *API) verify(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if r.Body == nil {
+		sendJSONMessage(w, "Please send a request body", http.StatusBadRequest)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxVerifyUploadSize)
+
+	var query VerifyRequest
+	if contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); contentType == "text/csv" {
+		cases, err := db.ReadVerifyCSV(body)
+		if err != nil {
+			sendValidationErrors(w, db.ValidationErrors{{Field: "csv", Code: db.ValidationInvalid, Message: err.Error()}})
+			return
+		}
+		query.Cases = cases
+	} else if err := json.NewDecoder(body).Decode(&query); err != nil {
+		sendJSONMessage(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if query.Domain != nil {
+		if errList := query.Domain.ValidateDraft(); len(errList) > 0 {
+			sendValidationErrors(w, errList)
+			return
+		}
+	}
+
+	sendJSON(w, db.Verify(query.Cases, api.verifyLookup(query.Domain)), http.StatusOK)
+}
@@ -0,0 +1,75 @@
+// Copyright 2018 Axel Springer SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/axelspringer/swerve/src/certificate"
+	"github.com/axelspringer/swerve/src/db"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Verify", func() {
+	It("Verify cases against a draft domain without id", func() {
+		api := NewAPIServer(":0", "secret", nil, certificate.NewManager(nil, false))
+
+		body := `{
+			"cases": [
+				{"url": "https://draft.example.com/a", "expected": "https://www.example.com/a"},
+				{"url": "https://draft.example.com/b", "expected": "https://www.example.com/a"}
+			],
+			"domain": {
+				"domain": "draft.example.com",
+				"redirect": "https://www.example.com/",
+				"code": 301,
+				"paths": [{"from": "/a", "to": "{scheme}://www.example.com/a"}]
+			}
+		}`
+		w := httptest.NewRecorder()
+		api.verify(w, httptest.NewRequest(http.MethodPost, "/api/verify", strings.NewReader(body)), nil)
+		Expect(w.Code).To(Equal(http.StatusOK))
+
+		var res struct {
+			Data db.VerifyReport `json:"data"`
+		}
+		Expect(json.NewDecoder(w.Body).Decode(&res)).To(BeNil())
+		Expect(res.Data.Passed).To(Equal(1))
+		Expect(res.Data.Failed).To(Equal(1))
+		Expect(res.Data.Failures[0].URL).To(Equal("https://draft.example.com/b"))
+	})
+
+	It("Verify rejects a malformed csv body with a json error", func() {
+		api := NewAPIServer(":0", "secret", nil, certificate.NewManager(nil, false))
+
+		r := httptest.NewRequest(http.MethodPost, "/api/verify", strings.NewReader("https://a.example.com/x\"y,https://b.example.com/\n"))
+		r.Header.Set("Content-Type", "text/csv; charset=utf-8")
+		w := httptest.NewRecorder()
+		api.verify(w, r, nil)
+		Expect(w.Code).To(Equal(http.StatusBadRequest))
+
+		var res struct {
+			Errors db.ValidationErrors `json:"errors"`
+		}
+		Expect(json.NewDecoder(w.Body).Decode(&res)).To(BeNil())
+		Expect(res.Errors).To(HaveLen(1))
+		Expect(res.Errors[0].Field).To(Equal("csv"))
+	})
+})